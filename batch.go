@@ -0,0 +1,170 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+// BatchCall is a single call within a batch request.
+type BatchCall struct {
+	Method string
+	Args   interface{}
+
+	// Reply is a pointer that the result of the call is decoded into.
+	Reply interface{}
+
+	// Error is set by DecodeClientBatchResponse if the call failed.
+	Error error
+
+	id uint64
+}
+
+// EncodeClientBatch encodes several calls as a single gob-RPC batch request,
+// to be sent to a handler created by BatchHandler(). Each call is assigned
+// a request id so that DecodeClientBatchResponse can match results back to
+// it, so the same slice must be passed to both.
+func EncodeClientBatch(calls []BatchCall) ([]byte, error) {
+	reqs := make([]*rpcRequest, len(calls))
+	for i := range calls {
+		calls[i].id = IDGenerator()
+		reqs[i] = &rpcRequest{
+			Method: calls[i].Method,
+			Params: calls[i].Args,
+			Id:     calls[i].id,
+			Schema: schemaOf(calls[i].Args),
+		}
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(reqs)
+	return buf.Bytes(), encodeError(err)
+}
+
+// DecodeClientBatchResponse decodes the response to a batch request built
+// by EncodeClientBatch, decoding each result into the Reply of its call.
+//
+// A failed call has its Error field set and does not affect the others. The
+// returned error is only non-nil if the batch as a whole failed.
+func DecodeClientBatchResponse(r io.Reader, calls []BatchCall) error {
+	var responses []*rpcResponse
+	if err := gob.NewDecoder(r).Decode(&responses); err != nil {
+		return err
+	}
+
+	byID := make(map[uint64]*rpcResponse, len(responses))
+	for _, res := range responses {
+		if res.Id == 0 && res.Error != nil {
+			return res.Error
+		}
+		byID[res.Id] = res
+	}
+
+	for i := range calls {
+		res, ok := byID[calls[i].id]
+		if !ok {
+			calls[i].Error = NewError("missing response for batch call: " + calls[i].Method)
+			continue
+		}
+		calls[i].Error = res.decode(calls[i].Reply)
+	}
+	return nil
+}
+
+// BatchHandler returns an http.Handler that serves batch requests encoded
+// by EncodeClientBatch. Each call is dispatched to s in order, exactly as
+// if it had been sent on its own, so s must have this package's codec
+// registered for the Content-Type used by the client.
+//
+// One call failing does not prevent the others from running. Calls with an
+// id of zero are treated as notifications and have no response.
+func BatchHandler(s *rpc.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []*rpcRequest
+		body, err := requestBody(r)
+		if err == nil {
+			err = gob.NewDecoder(body).Decode(&reqs)
+		}
+		r.Body.Close()
+		if err != nil {
+			writeBatchResponse(w, http.StatusBadRequest, []*rpcResponse{{Error: NewError(err.Error())}})
+			return
+		}
+
+		responses := make([]*rpcResponse, 0, len(reqs))
+		for _, req := range reqs {
+			res := serveBatchCall(s, r, req)
+			if req.Id != 0 {
+				responses = append(responses, res)
+			}
+		}
+		writeBatchResponse(w, http.StatusOK, responses)
+	})
+}
+
+// serveBatchCall dispatches a single call from the batch request r to s.
+func serveBatchCall(s *rpc.Server, r *http.Request, req *rpcRequest) *rpcResponse {
+	var message bytes.Buffer
+	if err := gob.NewEncoder(&message).Encode(req); err != nil {
+		return &rpcResponse{Error: NewError(err.Error()), Id: req.Id}
+	}
+
+	sub, err := http.NewRequestWithContext(r.Context(), "POST", r.URL.String(), &message)
+	if err != nil {
+		return &rpcResponse{Error: NewError(err.Error()), Id: req.Id}
+	}
+	sub.Header = r.Header.Clone()
+	sub.Header.Del("Content-Encoding")
+	sub.Header.Del("Accept-Encoding")
+	sub.RemoteAddr = r.RemoteAddr
+
+	rec := newResponseBuffer()
+	s.ServeHTTP(rec, sub)
+	if req.Id == 0 {
+		return nil
+	}
+
+	res := new(rpcResponse)
+	if err := gob.NewDecoder(&rec.body).Decode(res); err != nil {
+		return &rpcResponse{Error: NewError("invalid response to batch call: " + req.Method), Id: req.Id}
+	}
+	return res
+}
+
+func writeBatchResponse(w http.ResponseWriter, status int, responses []*rpcResponse) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(responses); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", DefaultContentType)
+	w.WriteHeader(status)
+	io.Copy(w, &buf)
+}
+
+// responseBuffer is an http.ResponseWriter that holds the response in memory.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
@@ -0,0 +1,59 @@
+package gob
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	bs := httptest.NewServer(BatchHandler(rs))
+	defer bs.Close()
+
+	var first, second string
+	calls := []BatchCall{
+		{Method: "SomeService.Echo", Args: "one", Reply: &first},
+		{Method: "SomeService.Error"},
+		{Method: "SomeService.Echo", Args: "two", Reply: &second},
+	}
+
+	message, err := EncodeClientBatch(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(bs.URL, "application/gob; charset=binary", bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err := DecodeClientBatchResponse(resp.Body, calls); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls[0].Error != nil || first != "one" {
+		t.Errorf("unexpected result for first call: %q, %v", first, calls[0].Error)
+	}
+	if calls[1].Error == nil || calls[1].Error.Error() != "uh-oh" {
+		t.Errorf("unexpected error for second call: %v", calls[1].Error)
+	}
+	if calls[2].Error != nil || second != "two" {
+		t.Errorf("unexpected result for third call: %q, %v", second, calls[2].Error)
+	}
+}
+
+func TestBatchInvalidBody(t *testing.T) {
+	bs := httptest.NewServer(BatchHandler(rs))
+	defer bs.Close()
+
+	resp, err := http.Post(bs.URL, "application/gob; charset=binary", bytes.NewReader([]byte("garbage")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err := DecodeClientBatchResponse(resp.Body, nil); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+}
@@ -0,0 +1,120 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a Client whose circuit breaker is open,
+// without the call being sent to the server.
+var ErrCircuitOpen = NewError("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed means calls are sent as usual.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen means calls fail immediately with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen means the cooldown has passed, and a single call is
+	// being let through to probe whether the server has recovered.
+	CircuitHalfOpen
+)
+
+// CircuitBreaker keeps a Client from sending calls to a server that keeps
+// failing. After Threshold consecutive calls fail with a *TransportError,
+// the breaker opens and calls fail with ErrCircuitOpen for the duration of
+// Cooldown. After that, one call is let through: if it succeeds the breaker
+// closes again, and if it fails the breaker stays open for another
+// Cooldown.
+//
+// Errors returned by the remote method don't count as failures, since they
+// show that the server is up. Nor do calls that fail because their context
+// was cancelled or its deadline passed, since the caller gave up on them
+// rather than the server failing them. A CircuitBreaker may be shared by
+// several clients, and must not be copied after first use.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.Cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a call may be sent.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		return true
+	case CircuitHalfOpen:
+		// A probe is already in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call that it allowed,
+// which was made with ctx.
+func (b *CircuitBreaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up on the call, which says nothing about the
+		// server.
+		b.abandonLocked()
+		return
+	}
+
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		b.state, b.failures = CircuitClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.Threshold {
+		b.state, b.openedAt = CircuitOpen, time.Now()
+	}
+}
+
+// abandon updates the breaker for a call that it allowed but whose outcome
+// says nothing about the server, such as one that failed on the client's
+// side.
+func (b *CircuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.abandonLocked()
+}
+
+// abandonLocked is abandon for a caller that holds b.mu. A probe that was
+// abandoned lets another call probe in its place.
+func (b *CircuitBreaker) abandonLocked() {
+	if b.state == CircuitHalfOpen {
+		b.state = CircuitOpen
+	}
+}
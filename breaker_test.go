@@ -0,0 +1,119 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var down int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		rs.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	breaker := &CircuitBreaker{Threshold: 2, Cooldown: 20 * time.Millisecond}
+	c := NewClient(server.URL, nil)
+	c.CircuitBreaker = breaker
+
+	call := func() error {
+		return c.Call("SomeService.Echo", "hello", new(string))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call(); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("expected a transport error, got %v", err)
+		}
+	}
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("expected the breaker to be open, got %d", state)
+	}
+	if err := call(); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// A failed probe reopens the breaker.
+	time.Sleep(breaker.Cooldown)
+	if state := breaker.State(); state != CircuitHalfOpen {
+		t.Fatalf("expected the breaker to be half-open, got %d", state)
+	}
+	if err := call(); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("expected a transport error, got %v", err)
+	}
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("expected the breaker to be open again, got %d", state)
+	}
+
+	// A successful probe closes it.
+	atomic.StoreInt32(&down, 0)
+	time.Sleep(breaker.Cooldown)
+	if err := call(); err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("expected the breaker to be closed, got %d", state)
+	}
+}
+
+func TestCircuitBreakerCancelledCalls(t *testing.T) {
+	var down int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(DeadlineHeader) != "" {
+			<-release
+			return
+		}
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		rs.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	breaker := &CircuitBreaker{Threshold: 1, Cooldown: 20 * time.Millisecond}
+	c := NewClient(server.URL, nil)
+	c.CircuitBreaker = breaker
+
+	// Calls given up on by their callers don't count as failures.
+	hang := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		return c.CallContext(ctx, "SomeService.Echo", "hello", new(string))
+	}
+	for i := 0; i < 3; i++ {
+		if err := hang(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the call to time out, got %v", err)
+		}
+	}
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("expected the breaker to stay closed, got %d", state)
+	}
+
+	// Nor do they leave the breaker half-open when they were the probe.
+	atomic.StoreInt32(&down, 1)
+	if err := c.Call("SomeService.Echo", "hello", new(string)); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("expected a transport error, got %v", err)
+	}
+	time.Sleep(breaker.Cooldown)
+	if err := hang(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the probe to time out, got %v", err)
+	}
+	atomic.StoreInt32(&down, 0)
+	if err := c.Call("SomeService.Echo", "hello", new(string)); err != nil {
+		t.Fatalf("expected another probe to be let through, got %v", err)
+	}
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("expected the breaker to be closed, got %d", state)
+	}
+}
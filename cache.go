@@ -0,0 +1,125 @@
+package gob
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// CacheResults returns a handler that memoizes the results of the named
+// methods, which must be pure, so that a call with the same params as an
+// earlier one is answered from cache for the duration of ttl, without
+// being passed to h. Calls to other methods are passed through unchanged.
+// Responses from the cache are written using codec, which should be the
+// codec registered with h for gob requests, so that they're compressed and
+// encoded in the same way as h's own; if it's nil, one returned by
+// NewCodec() is used.
+//
+// Results are keyed on the method and a hash of the gob encoding of the
+// params, and nothing else, so they're shared by every caller: a method
+// whose result depends on who is calling, such as through the request's
+// context or headers, must not be cached. Since gob doesn't encode maps in
+// a stable order, params holding maps may not be found in the cache even
+// when they're equal. Errors and notifications are never cached. Raw
+// results are cached and replayed byte for byte.
+//
+// The request body is read in full to find the method being called, so a
+// size limit should be applied by an earlier handler if one is needed.
+func CacheResults(h http.Handler, codec *Codec, cache ResponseCache, ttl time.Duration, methods ...string) http.Handler {
+	if codec == nil {
+		codec = NewCodec()
+	}
+	cached := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		cached[method] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := requestBody(r)
+		var message []byte
+		if err == nil {
+			message, err = ioutil.ReadAll(body)
+		}
+		r.Body.Close()
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, NewError(err.Error()))
+			return
+		}
+
+		// The body has been decompressed, so it's passed on without a
+		// Content-Encoding.
+		sub := r.Clone(r.Context())
+		sub.Body = ioutil.NopCloser(bytes.NewReader(message))
+		sub.ContentLength = int64(len(message))
+		sub.Header.Del("Content-Encoding")
+
+		var req rpcRequest
+		if err := gob.NewDecoder(bytes.NewReader(message)).Decode(&req); err != nil || req.Id == 0 || req.Stream || !cached[req.Method] {
+			h.ServeHTTP(w, sub)
+			return
+		}
+		key, err := resultKey(&req)
+		if err != nil {
+			h.ServeHTTP(w, sub)
+			return
+		}
+
+		// The response is requested as uncompressed gob so that it can
+		// be cached as is, and encoded for each caller when it's
+		// written.
+		sub.Header.Del("Accept-Encoding")
+		sub.Header.Del("Accept")
+
+		res, ok := cache.Get(key)
+		if !ok {
+			buf := newResponseBuffer()
+			h.ServeHTTP(buf, sub)
+			res = &CachedResponse{StatusCode: buf.status, Header: buf.header, Body: buf.body.Bytes()}
+			if res.StatusCode != http.StatusOK {
+				res.writeTo(w)
+				return
+			}
+			cache.Set(key, res, ttl)
+		}
+		writeCachedResult(w, r, codec, res, req.Id)
+	})
+}
+
+// resultKey returns the cache key for the result of req.
+func resultKey(req *rpcRequest) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&rpcRequest{Params: req.Params}); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return "gob-rpc result:" + req.Method + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// writeCachedResult writes a cached response to w as codec would for the
+// request r with the given id, compressing it if r allows.
+func writeCachedResult(w http.ResponseWriter, r *http.Request, codec *Codec, cached *CachedResponse, id uint64) {
+	if cached.Header.Get("Content-Type") != codec.contentType() {
+		// The result of a method with a RawResult reply isn't a
+		// gob-RPC response and carries no id, so it's replayed as it
+		// was written.
+		cached.writeTo(w)
+		return
+	}
+	var res rpcResponse
+	if err := gob.NewDecoder(bytes.NewReader(cached.Body)).Decode(&res); err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, NewError("invalid cached response: "+err.Error()))
+		return
+	}
+	res.Id = id
+
+	c := &CodecRequest{
+		codec:      codec,
+		request:    &rpcRequest{Id: id},
+		compressor: codec.compressor(r),
+		json:       codec.JSONResponses && prefersJSON(r.Header.Get("Accept")),
+	}
+	c.writeServerResponse(w, http.StatusOK, &res)
+}
@@ -0,0 +1,201 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type SquareService struct {
+	calls int64
+}
+
+func (s *SquareService) Square(r *http.Request, x *int, reply *int) error {
+	atomic.AddInt64(&s.calls, 1)
+	if *x < 0 {
+		return NewError("negative")
+	}
+	*reply = *x * *x
+	return nil
+}
+
+func (s *SquareService) Cube(r *http.Request, x *int, reply *int) error {
+	atomic.AddInt64(&s.calls, 1)
+	*reply = *x * *x * *x
+	return nil
+}
+
+func TestCacheResults(t *testing.T) {
+	svc := &SquareService{}
+	s, err := NewServer(ServiceReg{Service: svc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(CacheResults(s, nil, NewMemoryCache(), time.Minute, "SquareService.Square"))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	c.Compressor = Gzip
+	for _, test := range []struct {
+		method string
+		x      int
+		want   int
+		calls  int64
+	}{
+		{"SquareService.Square", 3, 9, 1},
+		{"SquareService.Square", 3, 9, 1},
+		{"SquareService.Square", 4, 16, 2},
+		{"SquareService.Square", -1, 0, 3},
+		{"SquareService.Square", -1, 0, 4},
+		{"SquareService.Cube", 2, 8, 5},
+		{"SquareService.Cube", 2, 8, 6},
+	} {
+		var reply int
+		err := c.Call(test.method, test.x, &reply)
+		if test.x < 0 {
+			if err == nil {
+				t.Errorf("%s(%d): expected an error, but none was returned", test.method, test.x)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		} else if reply != test.want {
+			t.Errorf("%s(%d): expected %d, got %d", test.method, test.x, test.want, reply)
+		}
+		if calls := atomic.LoadInt64(&svc.calls); calls != test.calls {
+			t.Errorf("%s(%d): expected %d calls to reach the service, got %d", test.method, test.x, test.calls, calls)
+		}
+	}
+}
+
+func TestCacheResultsID(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &SquareService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(CacheResults(s, nil, NewMemoryCache(), time.Minute, "SquareService.Square"))
+	defer server.Close()
+
+	for _, id := range []uint64{1, 2} {
+		message, err := EncodeClientRequestWithID("SquareService.Square", 5, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := newRequest(context.Background(), server.URL, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply int
+		got, err := DecodeClientResponseWithID(resp.Body, &reply)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != id || reply != 25 {
+			t.Errorf("expected id %d and result 25, got id %d and result %d", id, got, reply)
+		}
+	}
+}
+
+func TestCacheResultsJSONAccept(t *testing.T) {
+	svc := &SquareService{}
+	s, err := NewServer(ServiceReg{Service: svc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec()
+	codec.JSONResponses = true
+	s.RegisterCodec(codec, "application/gob")
+	server := httptest.NewServer(CacheResults(s, codec, NewMemoryCache(), time.Minute, "SquareService.Square"))
+	defer server.Close()
+
+	// Results are cached as gob, and written as JSON for calls asking
+	// for it, whether they're answered from cache or not.
+	for i := 0; i < 2; i++ {
+		req, err := BuildRequest(server.URL, "SquareService.Square", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", JSONContentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); mediaType(ct) != JSONContentType {
+			t.Errorf("call %d: expected a JSON response, got Content-Type %q", i, ct)
+		}
+	}
+
+	var reply int
+	if err := NewClient(server.URL, nil).Call("SquareService.Square", 3, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != 9 {
+		t.Errorf("expected 9, got %d", reply)
+	}
+	if calls := atomic.LoadInt64(&svc.calls); calls != 1 {
+		t.Errorf("expected 1 call to reach the service, got %d", calls)
+	}
+}
+
+func TestCacheResultsCompression(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &SquareService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec()
+	codec.Compressors = []Compressor{Deflate}
+	s.RegisterCodec(codec, "application/gob")
+	server := httptest.NewServer(CacheResults(s, codec, NewMemoryCache(), time.Minute, "SquareService.Square"))
+	defer server.Close()
+
+	// Both cached and uncached methods are compressed as the codec
+	// would compress them.
+	for _, method := range []string{"SquareService.Square", "SquareService.Square", "SquareService.Cube"} {
+		req, err := BuildRequest(server.URL, method, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply int
+		err = DecodeResponse(resp, &reply)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ce := resp.Header.Get("Content-Encoding"); ce != "deflate" {
+			t.Errorf("%s: expected a deflate response, got Content-Encoding %q", method, ce)
+		}
+	}
+}
+
+func TestCacheResultsRaw(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: BlobService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(CacheResults(s, nil, NewMemoryCache(), time.Minute, "BlobService.Render"))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	for i := 0; i < 2; i++ {
+		raw, err := c.CallRaw(context.Background(), "BlobService.Render", "gopher")
+		if err != nil {
+			t.Fatalf("call %d: %s", i, err)
+		}
+		if raw.ContentType != "text/csv" || string(raw.Data) != "name\ngopher\n" {
+			t.Errorf("call %d: received unexpected result: %+v", i, raw)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package gob
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Client is a gob-RPC client that sends calls to one server URL, or to one
+// of several equivalent ones.
+//
+// A Client is safe for concurrent use by multiple goroutines, provided that
+// its fields aren't changed while it's making calls.
+type Client struct {
+	// RetryPolicy, if non-nil, causes failed calls to be retried. Since
+	// every call is subject to it, it should only be set on clients that
+	// call idempotent methods.
+	RetryPolicy *RetryPolicy
+
+	// CircuitBreaker, if non-nil, stops calls from being sent while the
+	// server appears to be down.
+	CircuitBreaker *CircuitBreaker
+
+	// Compressor, if non-nil, is used to compress request bodies, and is
+	// advertised to the server as the preferred encoding for responses.
+	Compressor Compressor
+
+	// ContentType, if non-empty, overrides the Content-Type of requests,
+	// for servers that registered the codec under a different media type.
+	ContentType string
+
+	// MaxResponseBytes, if positive, is the largest response body, after
+	// decompression, that the client will read. Larger responses fail with
+	// a *TransportError instead of being decoded.
+	MaxResponseBytes int64
+
+	// JSON, if true, causes calls made with Call, CallContext, Go and
+	// Notify to be sent to the server's Gorilla json codec instead of this
+	// one, for use where gob isn't viable. Args and replies must then be
+	// types that encoding/json can handle, and the decoded reply only has
+	// the fields that survive the trip through JSON. CallRaw and
+	// CallStream depend on gob, and fail if it is set.
+	JSON bool
+
+	// Keepalive, if true, asks the server to keep the connection busy
+	// while a call is running, so that long calls through a proxy with an
+	// idle timeout aren't cut off. It takes effect if the server is
+	// wrapped with Keepalive(), and is otherwise ignored.
+	Keepalive bool
+
+	// Interceptors wrap every call made by the client, including
+	// notifications and calls made with CallRaw or CallStream, with the
+	// first being the outermost, so that it's the first to see each call.
+	// Since they wrap the whole call, they see it once however many times
+	// it's retried or fails over. For a notification, the reply is nil;
+	// for CallRaw, it's the *RawResult to be returned; and for CallStream,
+	// the args are the send function.
+	Interceptors []Interceptor
+
+	// Selector decides the order in which endpoints are tried by a client
+	// created with NewClientWithEndpoints. If nil, InOrder is used.
+	Selector EndpointSelector
+
+	urls       []string
+	httpClient *http.Client
+}
+
+// RetryPolicy controls how a Client retries calls that fail.
+//
+// Only transport-level errors and responses with a status of 502 Bad
+// Gateway, 503 Service Unavailable or 504 Gateway Timeout are retried.
+// Other error responses, such as the 500 Internal Server Error sent along
+// with an error returned by the remote method, or the 504 that the codec
+// sends for a method that ran past its timeout, are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a call is attempted,
+	// including the first. Values less than 2 disable retries.
+	MaxAttempts int
+
+	// Backoff returns how long to wait before the given retry, numbered
+	// from 1. If nil, retries are attempted immediately.
+	Backoff func(retry int) time.Duration
+}
+
+// ExponentialBackoff returns a backoff function for a RetryPolicy that
+// waits base before the first retry and doubles the wait on every retry
+// after that, up to max.
+func ExponentialBackoff(base, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// NewClient returns a new client for calling methods on the gob-RPC server
+// located at url. If httpClient is nil, http.DefaultClient is used.
+func NewClient(url string, httpClient *http.Client) *Client {
+	return NewClientWithEndpoints([]string{url}, httpClient)
+}
+
+// NewClientWithEndpoints returns a new client for calling methods on a
+// gob-RPC service that is available at each of the given URLs. If a call
+// can't reach an endpoint, or receives a 502, 503 or 504 response from it,
+// the call fails over to the next endpoint chosen by the client's Selector.
+// If httpClient is nil, http.DefaultClient is used.
+//
+// Failover happens within a single attempt, so with a RetryPolicy set, a
+// call is only retried once every endpoint has failed.
+func NewClientWithEndpoints(urls []string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{urls: append([]string(nil), urls...), httpClient: httpClient}
+}
+
+// Call invokes the named method with args and decodes the result into reply.
+//
+// It encodes the request with EncodeClientRequest() and sends it using the
+// client's http.Client. If the call fails, the error is an *RPCError when it
+// was returned by the remote method, or a *TransportError otherwise.
+func (c *Client) Call(method string, args, reply interface{}) error {
+	return c.CallContext(context.Background(), method, args, reply)
+}
+
+// CallContext is like Call, but the request is bound to ctx, so cancelling
+// ctx or letting its deadline pass aborts the call, including any retries.
+func (c *Client) CallContext(ctx context.Context, method string, args, reply interface{}) error {
+	return c.intercept(ctx, method, args, reply, c.invoke)
+}
+
+// intercept makes a call with invoke, wrapped in the client's interceptors.
+func (c *Client) intercept(ctx context.Context, method string, args, reply interface{}, invoke Invoker) error {
+	if len(c.Interceptors) > 0 {
+		invoke = chainInterceptors(invoke, c.Interceptors)
+	}
+	return invoke(ctx, method, args, reply)
+}
+
+// invoke makes a call for CallContext, once any interceptors have been
+// applied.
+func (c *Client) invoke(ctx context.Context, method string, args, reply interface{}) (err error) {
+	var message []byte
+	if c.JSON {
+		message, err = EncodeJSONRequest(method, args)
+	} else {
+		message, err = EncodeClientRequest(method, args)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.CircuitBreaker != nil {
+		if !c.CircuitBreaker.allow() {
+			return ErrCircuitOpen
+		}
+		defer func() { c.CircuitBreaker.record(ctx, err) }()
+	}
+
+	resp, err := c.send(ctx, message)
+	if err != nil {
+		err = &TransportError{Err: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if c.JSON {
+		err = decodeJSONResponse(resp, reply, c.MaxResponseBytes)
+	} else {
+		err = decodeResponse(resp, reply, c.MaxResponseBytes)
+	}
+	return err
+}
+
+// CallWithHeaders is like CallContext, but also sets the given headers on
+// the request, in the same way as BuildRequestWithHeaders. They're sent
+// with every attempt at the call. It is shorthand for calling CallContext
+// with a context returned by WithHeaders.
+func (c *Client) CallWithHeaders(ctx context.Context, method string, args, reply interface{}, header http.Header) error {
+	return c.CallContext(WithHeaders(ctx, header), method, args, reply)
+}
+
+// Notify sends a notification for the named method, which the server
+// invokes without sending back a result. It returns once the server has
+// handled the notification, and only returns an error if the notification
+// couldn't be delivered or the server reported that it failed.
+func (c *Client) Notify(method string, args interface{}) error {
+	return c.intercept(context.Background(), method, args, nil, c.notify)
+}
+
+// notify sends a notification for Notify, once any interceptors have been
+// applied.
+func (c *Client) notify(ctx context.Context, method string, args, _ interface{}) error {
+	var (
+		message []byte
+		err     error
+	)
+	if c.JSON {
+		message, err = encodeJSONRequest(method, args, 0)
+	} else {
+		message, err = EncodeNotification(method, args)
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, message)
+	if err != nil {
+		return &TransportError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		if c.JSON {
+			return decodeJSONResponse(resp, nil, c.MaxResponseBytes)
+		}
+		return decodeResponse(resp, nil, c.MaxResponseBytes)
+	}
+	return nil
+}
+
+// Go invokes the named method asynchronously, in the manner of net/rpc's
+// Client.Go. Once the call completes and reply has been filled in, the
+// resulting error, which may be nil, is sent on the returned channel.
+// The reply must not be accessed until then.
+func (c *Client) Go(method string, args, reply interface{}) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Call(method, args, reply)
+	}()
+	return done
+}
+
+// Close closes any idle connections kept open by the client's underlying
+// transport, if it supports doing so. The client can still be used after
+// Close, but will need to open new connections. It always returns nil, and
+// exists so that a Client satisfies io.Closer.
+func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// Call invokes the named method on c with the given request and returns
+// the decoded result. It is a typed alternative to Client.Call, so that
+// the reply type is checked at compile time on the client.
+func Call[Req any, Resp any](c *Client, method string, req Req) (Resp, error) {
+	var resp Resp
+	err := c.Call(method, req, &resp)
+	return resp, err
+}
+
+// send posts an encoded message to the server, retrying according to the
+// client's retry policy. The request body is rebuilt for every attempt.
+func (c *Client) send(ctx context.Context, message []byte) (*http.Response, error) {
+	for retry := 1; ; retry++ {
+		resp, err := c.failover(ctx, message)
+		if !c.shouldRetry(retry, resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if c.RetryPolicy.Backoff != nil {
+			t := time.NewTimer(c.RetryPolicy.Backoff(retry))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// failover posts an encoded message to each of the client's endpoints in
+// turn, until one of them is available. The result for the last endpoint
+// tried is returned.
+func (c *Client) failover(ctx context.Context, message []byte) (*http.Response, error) {
+	if len(c.urls) == 0 {
+		return nil, NewError("no endpoints configured")
+	}
+	selector := c.Selector
+	if selector == nil {
+		selector = InOrder
+	}
+	urls := selector.Order(c.urls)
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i, url := range urls {
+		if i > 0 {
+			if ctx.Err() != nil {
+				return resp, err
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+		}
+		resp, err = c.post(ctx, url, message)
+		if err == nil && !unavailable(resp) {
+			break
+		}
+	}
+	return resp, err
+}
+
+// post sends a single HTTP request carrying an encoded message to url.
+func (c *Client) post(ctx context.Context, url string, message []byte) (*http.Response, error) {
+	req, err := newRequest(ctx, url, message)
+	if err != nil {
+		return nil, err
+	}
+	if c.JSON {
+		req.Header.Set("Content-Type", JSONContentType)
+		req.Header.Set("Accept", JSONContentType)
+	}
+	if c.ContentType != "" {
+		req.Header.Set("Content-Type", c.ContentType)
+	}
+	if c.Compressor != nil {
+		if err := CompressRequestWith(req, c.Compressor); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept-Encoding", c.Compressor.Encoding())
+	}
+	if c.Keepalive {
+		req.Header.Set(KeepaliveHeader, "1")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := readKeepalive(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// shouldRetry reports whether the outcome of an attempt warrants
+// retrying, given that it would be the given retry.
+func (c *Client) shouldRetry(retry int, resp *http.Response, err error) bool {
+	if c.RetryPolicy == nil || retry >= c.RetryPolicy.MaxAttempts {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return unavailable(resp)
+}
+
+// unavailable reports whether resp indicates that the server, or a proxy
+// in front of it, couldn't handle the request at all. Unlike other errors,
+// the call can safely be attempted again.
+func unavailable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	case http.StatusGatewayTimeout:
+		// The codec sends this status for a method that ran past its
+		// timeout, which may not be safe to run again, so only a
+		// proxy's is.
+		mt := mediaType(resp.Header.Get("Content-Type"))
+		return !strings.Contains(mt, "gob") && mt != JSONContentType
+	}
+	return false
+}
+
+// DecodeResponse decodes the HTTP response to a gob-RPC call into reply.
+// Unlike DecodeClientResponse, it takes the whole *http.Response, so it can
+// decompress a compressed body and make use of the status code.
+//
+// A response from a server wrapped with Keepalive() is read past its
+// keepalive padding first.
+//
+// Errors returned by the remote method are reported as an *RPCError, and
+// all other failures as a *TransportError.
+func DecodeResponse(resp *http.Response, reply interface{}) error {
+	if err := readKeepalive(resp); err != nil {
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+	return decodeResponse(resp, reply, 0)
+}
+
+// decodeResponse is like DecodeResponse, but fails without decoding the
+// body if it is larger than limit bytes, unless limit is zero.
+func decodeResponse(resp *http.Response, reply interface{}, limit int64) error {
+	var (
+		body        io.Reader = resp.Body
+		text        string
+		undecodable bool
+	)
+	if resp.StatusCode >= 300 {
+		// Error responses aren't always gob-encoded, so hold on to the
+		// body in case it turns out to be a text message instead.
+		b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		if err != nil {
+			return &TransportError{StatusCode: resp.StatusCode, Err: err}
+		}
+		body = bytes.NewReader(b)
+		mt := mediaType(resp.Header.Get("Content-Type"))
+		if strings.HasPrefix(mt, "text/") || isText(b) {
+			text = strings.TrimSpace(string(b))
+		} else {
+			// A server that fails to encode an error, typically
+			// because its type isn't registered, may already have
+			// sent the status and headers of a gob response. Codecs
+			// registered under other media types usually still
+			// mention gob in them.
+			undecodable = resp.StatusCode >= 400 && strings.Contains(mt, "gob")
+			if len(b) > 0 {
+				text = fmt.Sprintf("not a gob-RPC response: %d bytes of %s", len(b), describeContentType(resp.Header.Get("Content-Type")))
+			}
+		}
+	}
+
+	body, err := responseBody(resp.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+	if limit > 0 {
+		body = http.MaxBytesReader(nil, ioutil.NopCloser(body), limit)
+	}
+
+	var res rpcResponse
+	if err := gob.NewDecoder(body).Decode(&res); err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			err = NewError(fmt.Sprintf("response too large: limit is %d bytes", tooLarge.Limit))
+		case undecodable && (err == io.EOF || err == io.ErrUnexpectedEOF):
+			err = NewError("server returned an error that could not be decoded (likely an unregistered error type; use gob.NewError on the server)")
+		case text != "":
+			err = NewError(text)
+		case err == io.EOF:
+			err = NewError("empty gob-RPC response body")
+		}
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+	if res.Error != nil {
+		return &RPCError{Err: res.Error}
+	}
+	return res.decode(reply)
+}
+
+// isText reports whether b looks like a plain text message, such as the
+// body of an error response from a proxy that doesn't set a text
+// Content-Type.
+func isText(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func describeContentType(ct string) string {
+	if ct == "" {
+		return "unknown type"
+	}
+	return ct
+}
+
+// maxErrorBody is the most that will be read of an error response body.
+const maxErrorBody = 1 << 20
+
+// TransportError is returned by a Client when a call fails at the network
+// or HTTP level, such as when the server can't be reached or responds with
+// something other than a gob-RPC response. These are often worth retrying.
+type TransportError struct {
+	// StatusCode is the HTTP status of the response, or zero if no
+	// response was received.
+	StatusCode int
+	Err        error
+}
+
+func (e *TransportError) Error() string {
+	if e.StatusCode == 0 {
+		return "transport error: " + e.Err.Error()
+	}
+	return fmt.Sprintf("transport error (HTTP %d): %s", e.StatusCode, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// RPCError is returned by a Client when the remote method returned an
+// error. Err is the error as it was decoded from the response, so
+// errors.As can be used to retrieve a specific error type.
+type RPCError struct {
+	Err error
+}
+
+func (e *RPCError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RPCError) Unwrap() error {
+	return e.Err
+}
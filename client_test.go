@@ -0,0 +1,390 @@
+package gob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientCall(t *testing.T) {
+	c := NewClient(ts.URL, nil)
+	if c.httpClient != http.DefaultClient {
+		t.Error("expected a nil http.Client to fall back to http.DefaultClient")
+	}
+
+	for _, s := range []string{"hello", "world"} {
+		var reply string
+		if err := c.Call("SomeService.Echo", s, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != s {
+			t.Errorf("received unexpected response: %s", reply)
+		}
+	}
+}
+
+func TestClientCallError(t *testing.T) {
+	c := NewClient(ts.URL, ts.Client())
+	err := c.Call("SomeService.Error", nil, nil)
+	if err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if err.Error() != "uh-oh" {
+		t.Fatalf("received unexpected error: %s", err)
+	}
+}
+
+func TestClientCallContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var reply string
+	err := NewClient(ts.URL, nil).CallContext(ctx, "SomeService.Echo", "hello", &reply)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rs.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: ExponentialBackoff(time.Millisecond, 10*time.Millisecond)}
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestClientNoRetryOnRPCError(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		rs.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 3}
+
+	if err := c.Call("SomeService.Error", nil, nil); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestClientMaxResponseBytes(t *testing.T) {
+	c := NewClient(ts.URL, nil)
+	c.MaxResponseBytes = 256
+
+	var reply string
+	err := c.Call("SomeService.Echo", strings.Repeat("x", 1024), &reply)
+	var te *TransportError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected a *TransportError, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), "response too large: limit is 256 bytes") {
+		t.Fatalf("received unexpected error: %s", err)
+	}
+
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatalf("received unexpected error for a small response: %s", err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	for retry, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := backoff(retry + 1); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %s, want %s", retry+1, got, want*time.Millisecond)
+		}
+	}
+}
+
+func TestClientErrorKinds(t *testing.T) {
+	c := NewClient(ts.URL, nil)
+
+	err := c.Call("SomeService.NotFound", nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected an *RPCError, got %T: %v", err, err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Code != 404 {
+		t.Fatalf("expected the remote *Error to be unwrappable, got %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "something broke", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err = NewClient(server.URL, nil).Call("SomeService.Echo", "hello", new(string))
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected a *TransportError, got %T: %v", err, err)
+	}
+	if transportErr.StatusCode != http.StatusInternalServerError || transportErr.Err.Error() != "something broke" {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+}
+
+func TestDecodeResponseNonGob(t *testing.T) {
+	for _, test := range []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"", "upstream connect error", "transport error (HTTP 502): upstream connect error"},
+		{"application/octet-stream", "\x00\x01\x02", "transport error (HTTP 502): not a gob-RPC response: 3 bytes of application/octet-stream"},
+		{"", "\x00\x01", "transport error (HTTP 502): not a gob-RPC response: 2 bytes of unknown type"},
+	} {
+		resp := &http.Response{
+			StatusCode: http.StatusBadGateway,
+			Header:     http.Header{"Content-Type": {test.contentType}},
+			Body:       ioutil.NopCloser(strings.NewReader(test.body)),
+		}
+		if test.contentType == "" {
+			resp.Header.Del("Content-Type")
+		}
+		if err := DecodeResponse(resp, new(string)); err == nil || err.Error() != test.want {
+			t.Errorf("%q: expected error %q, got %v", test.body, test.want, err)
+		}
+	}
+}
+
+func TestDecodeResponseUndecodableError(t *testing.T) {
+	const want = "server returned an error that could not be decoded (likely an unregistered error type; use gob.NewError on the server)"
+
+	message, err := EncodeClientRequest("SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"", string(message[:len(message)/2])} {
+		resp := &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Header:     http.Header{"Content-Type": {DefaultContentType}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}
+		if err := DecodeResponse(resp, nil); err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("%d byte body: received unexpected error: %v", len(body), err)
+		}
+	}
+
+	// Without a Content-Type, an empty body is as likely to come from a
+	// proxy, so no guess is made.
+	resp := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	if err := DecodeResponse(resp, nil); err == nil || strings.HasSuffix(err.Error(), want) {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
+
+func TestTypedCall(t *testing.T) {
+	c := NewTestClient(rs)
+
+	reply, err := Call[string, string](c, "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+
+	if _, err := Call[string, int](c, "SomeService.Echo", "hello"); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+}
+
+func TestClientGo(t *testing.T) {
+	c := NewClient(ts.URL, nil)
+
+	replies := make([]string, 3)
+	calls := make([]<-chan error, len(replies))
+	for i := range replies {
+		calls[i] = c.Go("SomeService.Echo", string(rune('a'+i)), &replies[i])
+	}
+
+	for i, done := range calls {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if want := string(rune('a' + i)); replies[i] != want {
+			t.Errorf("expected reply %q, got %q", want, replies[i])
+		}
+	}
+}
+
+type idleCloser struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleCloser) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestClientClose(t *testing.T) {
+	transport := &idleCloser{RoundTripper: http.DefaultTransport}
+	c := NewClient(ts.URL, &http.Client{Transport: transport})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if transport.closed != 1 {
+		t.Errorf("expected idle connections to be closed once, got %d", transport.closed)
+	}
+
+	// Transports that can't close idle connections are left alone.
+	c = NewClient(ts.URL, &http.Client{Transport: struct{ http.RoundTripper }{http.DefaultTransport}})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatalf("expected the client to be usable after Close: %s", err)
+	}
+}
+
+type NotifiedService struct {
+	received chan string
+}
+
+func (s *NotifiedService) Record(_ *http.Request, args *string, _ *struct{}) error {
+	s.received <- *args
+	return nil
+}
+
+func TestNotification(t *testing.T) {
+	svc := &NotifiedService{received: make(chan string, 1)}
+	s, err := NewServer(ServiceReg{Service: svc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	if err := NewClient(server.URL, nil).Notify("NotifiedService.Record", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-svc.received; got != "hello" {
+		t.Errorf("expected the handler to receive %q, got %q", "hello", got)
+	}
+
+	message, err := EncodeNotification("NotifiedService.Record", "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(server.URL, DefaultContentType, bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	<-svc.received
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 0 {
+		t.Errorf("expected an empty response body, got %d bytes", len(body))
+	}
+}
+
+type HeaderService struct{}
+
+func (HeaderService) Get(r *http.Request, name *string, reply *string) error {
+	*reply = r.Header.Get(*name)
+	return nil
+}
+
+func TestCallWithHeaders(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: HeaderService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTestClient(s)
+	header := http.Header{
+		"X-Tenant":     {"acme"},
+		"Content-Type": {"text/plain"},
+	}
+
+	var reply string
+	if err := c.CallWithHeaders(context.Background(), "HeaderService.Get", "X-Tenant", &reply, header); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "acme" {
+		t.Errorf("expected the X-Tenant header to arrive, got %q", reply)
+	}
+	if err := c.CallWithHeaders(context.Background(), "HeaderService.Get", "Content-Type", &reply, header); err != nil {
+		t.Fatal(err)
+	}
+	if reply != DefaultContentType {
+		t.Errorf("expected the Content-Type not to be overridden, got %q", reply)
+	}
+
+	// Headers only apply to the call they're given to.
+	if err := c.Call("HeaderService.Get", "X-Tenant", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "" {
+		t.Errorf("expected no X-Tenant header, got %q", reply)
+	}
+
+	req, err := BuildRequestWithHeaders("/", "HeaderService.Get", "X-Tenant", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("X-Tenant") != "acme" || req.Header.Get("Content-Type") != DefaultContentType {
+		t.Errorf("received unexpected headers: %v", req.Header)
+	}
+}
+
+func TestClientRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/rpc", rs)
+	mux.Handle("/old", http.RedirectHandler("/rpc", http.StatusTemporaryRedirect))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, comp := range []Compressor{nil, Gzip} {
+		c := NewClient(server.URL+"/old", nil)
+		c.Compressor = comp
+		var reply string
+		if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+			t.Fatalf("compressor %v: %s", comp, err)
+		}
+		if reply != "hello" {
+			t.Errorf("compressor %v: expected the body to be resent, got %q", comp, reply)
+		}
+	}
+}
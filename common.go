@@ -0,0 +1,32 @@
+package gob
+
+import (
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// RegisterCommon registers commonly used standard library types that gob
+// doesn't register itself, such as time.Time and net.IP, along with the
+// maps and slices of interface values that often hold them. Types only
+// have to be registered when they're sent as interface values, such as
+// in a map[string]interface{}, or as the params or result of a call.
+//
+// Registration isn't automatic, since gob panics if the same type is
+// registered under two different names, which would break programs that
+// already register any of these types themselves. RegisterCommon may be
+// called more than once.
+func RegisterCommon() {
+	RegisterTypes(
+		time.Time{},
+		time.Duration(0),
+		net.IP{},
+		url.URL{},
+		&big.Int{},
+		map[string]string{},
+		map[string]int{},
+		map[string]interface{}{},
+		[]interface{}{},
+	)
+}
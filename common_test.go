@@ -0,0 +1,70 @@
+package gob
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type CommonService struct{}
+
+func (CommonService) Time(_ *http.Request, args *time.Time, reply *time.Time) error {
+	*reply = *args
+	return nil
+}
+
+func (CommonService) IP(_ *http.Request, args *net.IP, reply *net.IP) error {
+	*reply = *args
+	return nil
+}
+
+func (CommonService) Event(_ *http.Request, args *CommonEvent, reply *CommonEvent) error {
+	*reply = *args
+	return nil
+}
+
+type CommonEvent struct {
+	At   time.Time
+	Meta map[string]interface{}
+}
+
+func TestRegisterCommon(t *testing.T) {
+	RegisterCommon()
+	RegisterCommon()
+	Register(CommonEvent{})
+
+	s, err := NewServer(ServiceReg{Service: CommonService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTestClient(s)
+
+	at := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	var gotTime time.Time
+	if err := c.Call("CommonService.Time", at, &gotTime); err != nil {
+		t.Fatal(err)
+	}
+	if !gotTime.Equal(at) {
+		t.Errorf("expected %s, got %s", at, gotTime)
+	}
+
+	ip := net.ParseIP("192.0.2.1")
+	var gotIP net.IP
+	if err := c.Call("CommonService.IP", ip, &gotIP); err != nil {
+		t.Fatal(err)
+	}
+	if !gotIP.Equal(ip) {
+		t.Errorf("expected %s, got %s", ip, gotIP)
+	}
+
+	ev := CommonEvent{At: at, Meta: map[string]interface{}{"seen": at, "tags": []interface{}{"a", 1}, "after": 90 * time.Second}}
+	var gotEvent CommonEvent
+	if err := c.Call("CommonService.Event", ev, &gotEvent); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotEvent, ev) {
+		t.Errorf("expected %#v, got %#v", ev, gotEvent)
+	}
+}
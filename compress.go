@@ -0,0 +1,249 @@
+package gob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compressor compresses request and response bodies for a particular
+// Content-Encoding. Gzip is provided by this package, and Snappy by the
+// github.com/dradtke/gob-rpc/snappy package. Others can be added with
+// RegisterCompressor.
+type Compressor interface {
+	// Encoding returns the Content-Encoding token identifying the
+	// compression format, such as "gzip".
+	Encoding() string
+
+	// NewWriter returns a writer that compresses data written to it and
+	// writes it to w. Closing it flushes any remaining data, but doesn't
+	// close w.
+	NewWriter(w io.Writer) io.WriteCloser
+
+	// NewReader returns a reader that decompresses data read from r.
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// Gzip is a Compressor for the "gzip" Content-Encoding. It produces the
+// smallest bodies of the built-in compressors, at a higher CPU cost.
+var Gzip Compressor = gzipCompressor{level: gzip.DefaultCompression}
+
+type gzipCompressor struct {
+	level int
+}
+
+// gzipWithLevel returns a gzip Compressor that compresses at the given
+// level, or at gzip.DefaultCompression if level is zero or invalid.
+func gzipWithLevel(level int) Compressor {
+	if level == 0 || level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return Gzip
+	}
+	return gzipCompressor{level: level}
+}
+
+func (gzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+func (c gzipCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	pool := &gzipWriters[c.level-gzip.HuffmanOnly]
+	zw, _ := pool.Get().(*gzip.Writer)
+	if zw == nil {
+		// The level has already been checked, so this can't fail.
+		zw, _ = gzip.NewWriterLevel(w, c.level)
+	} else {
+		zw.Reset(w)
+	}
+	return &pooledGzipWriter{Writer: zw, pool: pool}
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// gzipWriters holds reusable gzip writers for each compression level, from
+// gzip.HuffmanOnly to gzip.BestCompression, since allocating one is costly.
+var gzipWriters [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// pooledGzipWriter returns its gzip writer to the pool once closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// compressors holds the registered compressors by encoding, which are
+// always understood when decompressing a body.
+var compressors = struct {
+	sync.RWMutex
+	m map[string]Compressor
+}{m: map[string]Compressor{Gzip.Encoding(): Gzip}}
+
+// RegisterCompressor makes bodies compressed with c's Content-Encoding
+// understood by the codec and by clients, replacing any compressor already
+// registered for it. Gzip is always registered. Other compressors live in
+// packages of their own, which register them when they're imported, so
+// that programs only depend on the compression libraries they use:
+//
+//	import "github.com/dradtke/gob-rpc/snappy"
+//
+//	codec.Compressors = []gob.Compressor{snappy.Compressor, gob.Gzip}
+//
+// Registering a compressor doesn't cause it to be used for responses;
+// that's up to each codec's Compressors.
+func RegisterCompressor(c Compressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.m[normalizeEncoding(c.Encoding())] = c
+}
+
+// lookupCompressor returns the compressor registered for encoding, which
+// must already be normalized.
+func lookupCompressor(encoding string) (Compressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	c, ok := compressors.m[encoding]
+	return c, ok
+}
+
+// CompressRequest compresses the body of a request built by BuildRequest()
+// using gzip and sets its Content-Encoding header to match. The codec
+// transparently decompresses such requests on the server.
+func CompressRequest(req *http.Request) error {
+	return CompressRequestWith(req, Gzip)
+}
+
+// CompressRequestWith is like CompressRequest, but uses the given
+// compressor instead of gzip.
+func CompressRequestWith(req *http.Request, comp Compressor) error {
+	if req.Body == nil {
+		return nil
+	}
+	message, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := compressTo(&buf, message, comp); err != nil {
+		return err
+	}
+
+	// GetBody has to be replaced too, or a redirected request would be
+	// resent with the uncompressed body.
+	compressed := buf.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", comp.Encoding())
+	return nil
+}
+
+// compressTo writes the compressed form of b to w.
+func compressTo(w io.Writer, b []byte, comp Compressor) error {
+	zw := comp.NewWriter(w)
+	if _, err := zw.Write(b); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// requestBody returns a reader for the body of r, decompressing it if the
+// client sent it compressed. A GET request that AllowGET() has let through
+// is read from its query instead.
+func requestBody(r *http.Request) (io.Reader, error) {
+	if body, ok := queryBody(r); ok {
+		return body, nil
+	}
+	encoding := normalizeEncoding(r.Header.Get("Content-Encoding"))
+	if encoding == "" {
+		return r.Body, nil
+	}
+	comp, ok := lookupCompressor(encoding)
+	if !ok {
+		return nil, NewError("unsupported Content-Encoding: " + encoding)
+	}
+	return comp.NewReader(r.Body)
+}
+
+// responseBody returns a reader for a response body sent with the given
+// Content-Encoding, decompressing it if necessary.
+func responseBody(encoding string, body io.Reader) (io.Reader, error) {
+	encoding = normalizeEncoding(encoding)
+	if encoding == "" {
+		return body, nil
+	}
+	comp, ok := lookupCompressor(encoding)
+	if !ok {
+		return nil, NewError("unsupported Content-Encoding: " + encoding)
+	}
+	zr, err := comp.NewReader(body)
+	if err == io.EOF {
+		return nil, NewError("empty gob-RPC response body")
+	}
+	return zr, err
+}
+
+// normalizeEncoding returns the given Content-Encoding in lower case, or
+// the empty string if it denotes no encoding at all.
+func normalizeEncoding(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "identity" {
+		return ""
+	}
+	return encoding
+}
+
+// negotiateCompressor returns the first of prefs that the client that sent
+// r will accept, or nil if it accepts none of them.
+func negotiateCompressor(r *http.Request, prefs []Compressor) Compressor {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return nil
+	}
+	for _, comp := range prefs {
+		if acceptsEncoding(header, comp.Encoding()) {
+			return comp
+		}
+	}
+	return nil
+}
+
+// acceptsEncoding reports whether the given Accept-Encoding header allows
+// the given encoding.
+func acceptsEncoding(header, encoding string) bool {
+	for _, field := range strings.Split(header, ",") {
+		parts := strings.Split(field, ";")
+		if !strings.EqualFold(strings.TrimSpace(parts[0]), encoding) {
+			continue
+		}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
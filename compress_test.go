@@ -0,0 +1,323 @@
+package gob
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+// Deflate is a Compressor registered for the tests, standing in for those
+// of other packages, such as Snappy.
+var Deflate Compressor = deflateCompressor{}
+
+func init() {
+	RegisterCompressor(Deflate)
+}
+
+type deflateCompressor struct{}
+
+func (deflateCompressor) Encoding() string {
+	return "deflate"
+}
+
+func (deflateCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func (deflateCompressor) NewReader(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+func TestGzipRequest(t *testing.T) {
+	req, err := BuildRequest(ts.URL, "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var reply string
+	if err := DecodeClientResponse(resp.Body, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	req, err := BuildRequest(ts.URL, "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting Accept-Encoding explicitly disables the transport's
+	// transparent decompression.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("expected a gzip-encoded response, got Content-Encoding %q", ce)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply string
+	if err := DecodeClientResponse(zr, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+}
+
+func TestGzipLevel(t *testing.T) {
+	// Random ids would make the sizes of responses vary slightly.
+	defer func(g func() uint64) { IDGenerator = g }(IDGenerator)
+	IDGenerator = func() uint64 { return 1234 }
+
+	var payload string
+	for i := 0; i < 1000; i++ {
+		payload += fmt.Sprintf("item-%d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	sizes := make(map[int]int)
+	for _, level := range []int{0, gzip.BestSpeed, gzip.BestCompression} {
+		codec := NewCodec()
+		codec.GzipLevel = level
+		s := rpc.NewServer()
+		s.RegisterCodec(codec, "application/gob")
+		s.RegisterService(&SomeService{}, "")
+
+		// Compress twice, so that the second response reuses a pooled
+		// writer.
+		for i := 0; i < 2; i++ {
+			req, err := BuildRequest("/", "SomeService.Echo", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+
+			resp := w.Result()
+			var reply string
+			if err := DecodeResponse(resp, &reply); err != nil {
+				t.Fatalf("level %d: %s", level, err)
+			}
+			if reply != payload {
+				t.Fatalf("level %d: received unexpected response", level)
+			}
+			sizes[level] = w.Body.Len()
+		}
+	}
+	if sizes[gzip.BestCompression] > sizes[gzip.BestSpeed] {
+		t.Errorf("expected BestCompression to be no larger than BestSpeed, got %d > %d bytes", sizes[gzip.BestCompression], sizes[gzip.BestSpeed])
+	}
+
+	if comp := gzipWithLevel(42); comp != Gzip {
+		t.Errorf("expected an invalid level to fall back to Gzip, got %#v", comp)
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"deflate, GZIP":      true,
+		"gzip;q=0":           false,
+		"gzip;q=0.5, br":     true,
+		"deflate;q=1.0, br":  false,
+		"identity, gzip;q=0": false,
+	} {
+		if got := acceptsEncoding(header, "gzip"); got != want {
+			t.Errorf("acceptsEncoding(%q, \"gzip\") = %t, want %t", header, got, want)
+		}
+	}
+}
+
+func TestNegotiateCompressor(t *testing.T) {
+	prefs := []Compressor{Deflate, Gzip}
+	for header, want := range map[string]Compressor{
+		"":              nil,
+		"gzip":          Gzip,
+		"gzip, deflate": Deflate,
+		"br":            nil,
+	} {
+		r := &http.Request{Header: http.Header{"Accept-Encoding": {header}}}
+		if got := negotiateCompressor(r, prefs); got != want {
+			t.Errorf("negotiateCompressor(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestClientCompressor(t *testing.T) {
+	for _, comp := range []Compressor{Gzip, Deflate} {
+		codec := NewCodec()
+		codec.Compressors = []Compressor{Deflate, Gzip}
+		s := rpc.NewServer()
+		s.RegisterCodec(codec, "application/gob")
+		s.RegisterService(&SomeService{}, "")
+
+		var encodings []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodings = append(encodings, r.Header.Get("Content-Encoding"))
+			s.ServeHTTP(w, r)
+			encodings = append(encodings, w.Header().Get("Content-Encoding"))
+		}))
+
+		c := NewClient(server.URL, nil)
+		c.Compressor = comp
+		var reply string
+		err := c.Call("SomeService.Echo", "hello", &reply)
+		server.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", comp.Encoding(), err)
+		}
+		if reply != "hello" {
+			t.Errorf("%s: received unexpected response: %s", comp.Encoding(), reply)
+		}
+		if len(encodings) != 2 || encodings[0] != comp.Encoding() || encodings[1] != comp.Encoding() {
+			t.Errorf("%s: unexpected request and response encodings: %v", comp.Encoding(), encodings)
+		}
+	}
+}
+
+func BenchmarkCompression(b *testing.B) {
+	payload := make([]string, 1000)
+	for i := range payload {
+		payload[i] = fmt.Sprintf("item-%d: the quick brown fox jumps over the lazy dog", i)
+	}
+	message, err := EncodeClientRequest("SomeService.Echo", payload)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, comp := range []Compressor{nil, Gzip, Deflate} {
+		name := "none"
+		if comp != nil {
+			name = comp.Encoding()
+		}
+		b.Run(name, func(b *testing.B) {
+			var buf bytes.Buffer
+			b.SetBytes(int64(len(message)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if comp == nil {
+					buf.Write(message)
+					continue
+				}
+				if err := compressTo(&buf, message, comp); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len()), "bytes")
+		})
+	}
+}
+
+func BenchmarkGzipLevel(b *testing.B) {
+	payload := make([]string, 1000)
+	for i := range payload {
+		payload[i] = fmt.Sprintf("item-%d: the quick brown fox jumps over the lazy dog", i)
+	}
+	message, err := EncodeClientRequest("SomeService.Echo", payload)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, level := range []int{gzip.HuffmanOnly, gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		comp := gzipWithLevel(level)
+		b.Run(strconv.Itoa(level), func(b *testing.B) {
+			var buf bytes.Buffer
+			b.SetBytes(int64(len(message)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := compressTo(&buf, message, comp); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len()), "bytes")
+		})
+	}
+}
+
+func TestUnsupportedContentEncoding(t *testing.T) {
+	r, err := http.NewRequest("POST", "/", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Encoding", "br")
+	if _, err := NewCodec().NewRequest(r).Method(); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+}
+
+func TestDecodeResponseGzip(t *testing.T) {
+	req, err := BuildRequest(ts.URL, "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var reply string
+	if err := DecodeResponse(resp, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+}
+
+func TestDecodeResponseEncodingErrors(t *testing.T) {
+	for encoding, want := range map[string]string{
+		"gzip": "empty gob-RPC response body",
+		"":     "empty gob-RPC response body",
+		"br":   "unsupported Content-Encoding: br",
+	} {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Encoding": {encoding}},
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+		err := DecodeResponse(resp, new(string))
+		if err == nil {
+			t.Errorf("expected an error for Content-Encoding %q, but none was returned", encoding)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("received unexpected error for Content-Encoding %q: %s", encoding, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	idempotencyKey
+	responseWriterKey
+	gatewayKey
+	headersKey
+	getKey
+)
+
+// IDFromRequest returns the id of the gob-RPC request being handled, for
+// use by service methods. The boolean result reports whether r was decoded
+// by this package's codec. An id of zero indicates a notification.
+func IDFromRequest(r *http.Request) (uint64, bool) {
+	id, ok := r.Context().Value(requestIDKey).(uint64)
+	return id, ok
+}
+
+// IdempotencyKeyFromRequest returns the idempotency key sent by the client
+// in the Idempotency-Key header, for use by service methods. The boolean
+// result reports whether a key was sent.
+func IdempotencyKeyFromRequest(r *http.Request) (string, bool) {
+	key, ok := r.Context().Value(idempotencyKey).(string)
+	return key, ok
+}
+
+// ContextKey is a typed key for a request-scoped value that is attached to
+// a request before it reaches a service method, so that the method can read
+// it back without a type assertion. Each key created by NewContextKey is
+// distinct, even if it has the same name as another.
+//
+// A value such as an authenticated user is typically attached by HTTP
+// middleware wrapping the *rpc.Server:
+//
+//	var UserKey = gob.NewContextKey[*User]("user")
+//
+//	func Authenticate(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			user, err := lookupUser(r)
+//			...
+//			next.ServeHTTP(w, UserKey.Set(r, user))
+//		})
+//	}
+//
+// and then read by the service method:
+//
+//	func (s *Service) Method(r *http.Request, args *Args, reply *Reply) error {
+//		user, ok := UserKey.FromRequest(r)
+//		...
+//	}
+//
+// Values that depend on the method being called can instead be attached in
+// a function registered with the server's RegisterBeforeFunc, using
+// SetInPlace on the RequestInfo's request.
+type ContextKey[T any] struct {
+	name string
+}
+
+// NewContextKey returns a new key for values of type T. The name is only
+// used for debugging.
+func NewContextKey[T any](name string) *ContextKey[T] {
+	return &ContextKey[T]{name: name}
+}
+
+func (k *ContextKey[T]) String() string {
+	return "gob-rpc context key " + k.name
+}
+
+// WithValue returns a copy of ctx in which the key is associated with v.
+func (k *ContextKey[T]) WithValue(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k, v)
+}
+
+// Value returns the value associated with the key in ctx, and whether
+// there was one.
+func (k *ContextKey[T]) Value(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+// Set returns a shallow copy of r whose context associates the key with v.
+func (k *ContextKey[T]) Set(r *http.Request, v T) *http.Request {
+	return r.WithContext(k.WithValue(r.Context(), v))
+}
+
+// SetInPlace associates the key with v in the context of r itself, for
+// code that can't pass a new request on, such as Gorilla RPC's before
+// functions, which are given the same request as the service method.
+func (k *ContextKey[T]) SetInPlace(r *http.Request, v T) {
+	setContext(r, k.WithValue(r.Context(), v))
+}
+
+// FromRequest returns the value associated with the key in the context of
+// r, and whether there was one.
+func (k *ContextKey[T]) FromRequest(r *http.Request) (T, bool) {
+	return k.Value(r.Context())
+}
+
+// setContext replaces the context of r in place. Gorilla RPC passes the
+// same *http.Request to the codec and then to the service method, so this
+// is how values decoded by the codec are made available to handlers.
+func setContext(r *http.Request, ctx context.Context) {
+	*r = *r.WithContext(ctx)
+}
@@ -0,0 +1,61 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+var (
+	userKey   = NewContextKey[string]("user")
+	methodKey = NewContextKey[string]("method")
+)
+
+type WhoAmIService struct{}
+
+func (WhoAmIService) Get(r *http.Request, _ *struct{}, reply *[]string) error {
+	user, ok := userKey.FromRequest(r)
+	if !ok {
+		return NewError("no user")
+	}
+	method, _ := methodKey.FromRequest(r)
+	*reply = []string{user, method}
+	return nil
+}
+
+func TestContextKey(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: WhoAmIService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RegisterBeforeFunc(func(i *rpc.RequestInfo) {
+		methodKey.SetInPlace(i.Request, i.Method)
+	})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ServeHTTP(w, userKey.Set(r, "gopher"))
+	})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	var reply []string
+	if err := NewClient(server.URL, nil).Call("WhoAmIService.Get", nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply) != 2 || reply[0] != "gopher" || reply[1] != "WhoAmIService.Get" {
+		t.Errorf("received unexpected response: %v", reply)
+	}
+}
+
+func TestContextKeyDistinct(t *testing.T) {
+	a, b := NewContextKey[string]("same"), NewContextKey[string]("same")
+	ctx := a.WithValue(context.Background(), "a")
+	if _, ok := b.Value(ctx); ok {
+		t.Error("keys with the same name should be distinct")
+	}
+	if v, ok := a.Value(ctx); !ok || v != "a" {
+		t.Errorf("expected %q, got %q", "a", v)
+	}
+}
@@ -0,0 +1,50 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader is the HTTP header used to send the time remaining until a
+// client's deadline to the server, in milliseconds. The codec gives the
+// request context of the handler a matching deadline, so work can stop once
+// the client has given up.
+const DeadlineHeader = "X-Gob-RPC-Deadline"
+
+// maxDeadline is the longest deadline accepted from a client. Longer ones
+// are clamped to it.
+const maxDeadline = 24 * time.Hour
+
+// setDeadlineHeader sets the deadline header on req if ctx has a deadline.
+func setDeadlineHeader(req *http.Request, ctx context.Context) {
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		req.Header.Set(DeadlineHeader, strconv.FormatInt(remaining, 10))
+	}
+}
+
+// deadlineFromHeader returns the timeout sent by the client of r, if any.
+// A malformed header is ignored rather than failing the request.
+func deadlineFromHeader(r *http.Request) (time.Duration, bool) {
+	v := r.Header.Get(DeadlineHeader)
+	if v == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	switch {
+	case ms < 0:
+		ms = 0
+	case ms > maxDeadline.Milliseconds():
+		ms = maxDeadline.Milliseconds()
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
@@ -0,0 +1,134 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func (s *SomeService) Deadline(r *http.Request, _ *struct{}, reply *int64) error {
+	deadline, ok := r.Context().Deadline()
+	if !ok {
+		return NewError("no deadline")
+	}
+	*reply = time.Until(deadline).Milliseconds()
+	return nil
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var remaining int64
+	if err := NewClient(ts.URL, nil).CallContext(ctx, "SomeService.Deadline", nil, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining <= 0 || remaining > 5000 {
+		t.Errorf("expected the handler's deadline to be within 5s, got %dms", remaining)
+	}
+}
+
+func TestDeadlineFromHeader(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"garbage", 0, false},
+		{"1500", 1500 * time.Millisecond, true},
+		{"-10", 0, true},
+		{"999999999999", maxDeadline, true},
+	} {
+		r := httptest.NewRequest("POST", "/", nil)
+		if test.header != "" {
+			r.Header.Set(DeadlineHeader, test.header)
+		}
+		got, ok := deadlineFromHeader(r)
+		if got != test.want || ok != test.ok {
+			t.Errorf("deadlineFromHeader(%q) = %s, %t; want %s, %t", test.header, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+type SlowService struct{}
+
+// Sleep sleeps for the given number of milliseconds, ignoring its context.
+func (SlowService) Sleep(r *http.Request, ms *int, reply *string) error {
+	time.Sleep(time.Duration(*ms) * time.Millisecond)
+	*reply = "done"
+	return nil
+}
+
+// Wait waits for its context to be done.
+func (SlowService) Wait(r *http.Request, _ *struct{}, _ *struct{}) error {
+	<-r.Context().Done()
+	return r.Context().Err()
+}
+
+func TestMethodTimeouts(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec()
+	codec.MethodTimeouts = map[string]time.Duration{
+		"SlowService.Sleep":    20 * time.Millisecond,
+		"SlowService.Wait":     20 * time.Millisecond,
+		"SomeService.Deadline": time.Hour,
+	}
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterService(SlowService{}, "")
+	s.RegisterService(&SomeService{}, "")
+	var statuses []int
+	c := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		s.ServeHTTP(sw, r)
+		statuses = append(statuses, sw.status())
+	}))
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 3}
+
+	var reply string
+	if err := c.Call("SlowService.Sleep", 0, &reply); err != nil || reply != "done" {
+		t.Fatalf("expected a quick call to succeed, got %q, %v", reply, err)
+	}
+	for _, call := range []struct {
+		method string
+		args   interface{}
+		reply  interface{}
+	}{
+		{"SlowService.Sleep", 50, new(string)},
+		{"SlowService.Wait", nil, nil},
+	} {
+		statuses = nil
+		err := c.Call(call.method, call.args, call.reply)
+		var e *Error
+		if !errors.As(err, &e) || e.Code != http.StatusGatewayTimeout || e.Message != call.method+" timed out after 20ms" {
+			t.Errorf("%s: expected a timeout error, got %v", call.method, err)
+		}
+		// The method has already run, so it isn't retried.
+		if len(statuses) != 1 || statuses[0] != http.StatusGatewayTimeout {
+			t.Errorf("%s: expected a single response with status 504, got %v", call.method, statuses)
+		}
+	}
+
+	// A sooner deadline from the client is kept.
+	var remaining int64
+	if err := c.Call("SomeService.Deadline", nil, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining <= 5000 || remaining > time.Hour.Milliseconds() {
+		t.Errorf("expected the method's deadline to be within 1h, got %dms", remaining)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.CallContext(ctx, "SomeService.Deadline", nil, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining <= 0 || remaining > 5000 {
+		t.Errorf("expected the client's deadline of 5s to be kept, got %dms", remaining)
+	}
+}
@@ -0,0 +1,63 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// DebugRequest decodes a gob-RPC request body, such as one captured from
+// the network or a log, and formats it for reading:
+//
+//	method=SomeService.Echo id=1234 params=string(hello)
+//
+// The types of the params must be registered, as they would be on the
+// server. If they can't be decoded, the error still gives the method and
+// id when those could be read. The body must not be compressed.
+func DebugRequest(b []byte) (string, error) {
+	var req rpcRequest
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&req); err != nil {
+		var head struct {
+			Method string
+			Id     uint64
+		}
+		if gob.NewDecoder(bytes.NewReader(b)).Decode(&head) == nil {
+			return "", NewError(fmt.Sprintf("unable to decode the params of a request to %s with id %d: %s", head.Method, head.Id, err))
+		}
+		return "", NewError(fmt.Sprintf("unable to decode gob-RPC request: %s", err))
+	}
+	params := debugValue(req.Params)
+	if req.Stream {
+		params = "stream"
+	}
+	return fmt.Sprintf("method=%s id=%d params=%s", req.Method, req.Id, params), nil
+}
+
+// DebugResponse is like DebugRequest, but decodes a gob-RPC response body:
+//
+//	id=1234 result=string(hello)
+//	id=1234 error=*gob.Error(uh-oh)
+func DebugResponse(b []byte) (string, error) {
+	var res rpcResponse
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&res); err != nil {
+		var head struct {
+			Id uint64
+		}
+		if gob.NewDecoder(bytes.NewReader(b)).Decode(&head) == nil {
+			return "", NewError(fmt.Sprintf("unable to decode the result or error of a response with id %d: %s", head.Id, err))
+		}
+		return "", NewError(fmt.Sprintf("unable to decode gob-RPC response: %s", err))
+	}
+	if res.Error != nil {
+		return fmt.Sprintf("id=%d error=%T(%s)", res.Id, res.Error, res.Error), nil
+	}
+	return fmt.Sprintf("id=%d result=%s", res.Id, debugValue(res.Result)), nil
+}
+
+// debugValue formats a param or result with its type.
+func debugValue(v interface{}) string {
+	if v == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%T(%+v)", v, v)
+}
@@ -0,0 +1,65 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+func TestDebugRequest(t *testing.T) {
+	message, err := EncodeClientRequestWithID("SomeService.Echo", HealthStatus{Status: "ok"}, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DebugRequest(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "method=SomeService.Echo id=1234 params=gob.HealthStatus({Status:ok Services:[]})"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := DebugRequest([]byte("not gob")); err == nil || !strings.HasPrefix(err.Error(), "unable to decode gob-RPC request: ") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+
+	// A request whose params are of an unregistered type still has its
+	// method and id reported.
+	var buf bytes.Buffer
+	gob.RegisterName("debugOnlyOnTheClient", struct{ X int }{})
+	if err := writeRequest(&buf, "SomeService.Echo", struct{ X int }{3}, 7); err != nil {
+		t.Fatal(err)
+	}
+	b := bytes.Replace(buf.Bytes(), []byte("debugOnlyOnTheClient"), []byte("debugNotRegistered!!"), 1)
+	if _, err := DebugRequest(b); err == nil || !strings.HasPrefix(err.Error(), "unable to decode the params of a request to SomeService.Echo with id 7: ") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
+
+func TestDebugResponse(t *testing.T) {
+	for _, test := range []struct {
+		res  *rpcResponse
+		want string
+	}{
+		{&rpcResponse{Result: "hello", Id: 1}, "id=1 result=string(hello)"},
+		{&rpcResponse{Id: 2}, "id=2 result=nil"},
+		{&rpcResponse{Error: NewError("uh-oh"), Id: 3}, "id=3 error=*gob.Error(uh-oh)"},
+	} {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(test.res); err != nil {
+			t.Fatal(err)
+		}
+		got, err := DebugResponse(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("expected %q, got %q", test.want, got)
+		}
+	}
+
+	if _, err := DebugResponse(nil); err == nil || !strings.HasPrefix(err.Error(), "unable to decode gob-RPC response: ") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// ErrShuttingDown is sent to clients by a Drainer that has been told to
+// drain. Its code is 503, matching the HTTP status of the response, so
+// clients with a RetryPolicy or several endpoints try again elsewhere.
+var ErrShuttingDown = NewErrorCode(http.StatusServiceUnavailable, "server shutting down")
+
+// Drainer wraps a handler, usually a Gorilla RPC server, to keep track of
+// the calls in progress, so that a server can be shut down without
+// interrupting them. It is meant to be used alongside http.Server's
+// Shutdown, which waits for connections to go idle but doesn't reject
+// calls arriving on connections that are still open:
+//
+//	d := gob.NewDrainer(s)
+//	srv := &http.Server{Handler: d}
+//	...
+//	d.Drain(ctx)
+//	srv.Shutdown(ctx)
+type Drainer struct {
+	h        http.Handler
+	mu       sync.Mutex
+	draining bool
+	active   sync.WaitGroup
+}
+
+// NewDrainer returns a Drainer that passes requests on to h.
+func NewDrainer(h http.Handler) *Drainer {
+	return &Drainer{h: h}
+}
+
+func (d *Drainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		r.Body.Close()
+		writeErrorResponse(w, http.StatusServiceUnavailable, ErrShuttingDown)
+		return
+	}
+	d.active.Add(1)
+	d.mu.Unlock()
+
+	defer d.active.Done()
+	d.h.ServeHTTP(w, r)
+}
+
+// Drain stops new calls from being passed on, rejecting them with
+// ErrShuttingDown instead, and waits for the calls in progress to finish.
+// It returns ctx.Err() if ctx is done first, in which case calls are
+// still rejected. Calling Drain more than once is allowed.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,50 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	d := NewDrainer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		rs.ServeHTTP(w, r)
+	}))
+	server := httptest.NewServer(d)
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	var reply string
+	call := c.Go("SomeService.Echo", "in flight", &reply)
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the drain to time out, got %v", err)
+	}
+
+	err := c.Call("SomeService.Echo", "too late", new(string))
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected ErrShuttingDown, got %v", err)
+	}
+
+	drained := make(chan error)
+	go func() { drained <- d.Drain(context.Background()) }()
+	close(release)
+	if err := <-call; err != nil {
+		t.Fatal(err)
+	}
+	if reply != "in flight" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+}
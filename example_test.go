@@ -0,0 +1,174 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+// QuotaError is a custom error type that carries structured information
+// about the failure.
+type QuotaError struct {
+	User  string
+	Quota int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s has exceeded their quota of %d", e.User, e.Quota)
+}
+
+type UploadService struct{}
+
+func (s *UploadService) Upload(r *http.Request, args *string, reply *struct{}) error {
+	return &QuotaError{User: *args, Quota: 100}
+}
+
+// Custom error types can be returned from service methods as long as
+// they are registered on both the client and the server. The client
+// receives the same concrete type with its fields intact.
+func ExampleNewError_customType() {
+	Register(&QuotaError{})
+
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	s.RegisterService(&UploadService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	err := NewClient(server.URL, nil).Call("UploadService.Upload", "alice", nil)
+	var qe *QuotaError
+	if errors.As(err, &qe) {
+		fmt.Println(qe.User, qe.Quota)
+	}
+	// Output: alice 100
+}
+
+// FieldError describes a problem with one field of a request.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError reports every problem found with a request at once.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation failed for %d field(s)", len(e.Fields))
+}
+
+type SignupService struct{}
+
+func (s *SignupService) Signup(r *http.Request, args *map[string]string, reply *struct{}) error {
+	verr := &ValidationError{}
+	for _, field := range []string{"email", "name"} {
+		if (*args)[field] == "" {
+			verr.Fields = append(verr.Fields, FieldError{Field: field, Message: "is required"})
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Registering an error type lets the client reconstruct it in full,
+// including fields that hold slices of other structs.
+func ExampleRegisterError() {
+	RegisterError(&ValidationError{})
+	Register(map[string]string{})
+
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	s.RegisterService(&SignupService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	err := NewClient(server.URL, nil).Call("SignupService.Signup", map[string]string{"name": "alice"}, nil)
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		fmt.Println(err)
+		for _, f := range verr.Fields {
+			fmt.Println(f.Field, f.Message)
+		}
+	}
+	// Output:
+	// validation failed for 1 field(s)
+	// email is required
+}
+
+type GreetService struct{}
+
+func (s *GreetService) Greet(r *http.Request, args *string, reply *string) error {
+	*reply = "hello, " + *args
+	return nil
+}
+
+// An interceptor can add headers to every call, such as to authenticate
+// the client to a server that requires it.
+func ExampleInterceptor_authHeader() {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	s.RegisterService(&GreetService{}, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	c.Interceptors = []Interceptor{func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, reply interface{}) error {
+			ctx = WithHeaders(ctx, http.Header{"Authorization": {"Bearer secret"}})
+			return next(ctx, method, args, reply)
+		}
+	}}
+
+	var reply string
+	if err := c.Call("GreetService.Greet", "alice", &reply); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(reply)
+	// Output: hello, alice
+}
+
+// An interceptor can also observe every call, such as to log how long
+// each one took.
+func ExampleInterceptor_latencyLogger() {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	s.RegisterService(&GreetService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	logLatency := func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, reply interface{}) error {
+			start := time.Now()
+			err := next(ctx, method, args, reply)
+			// A real logger would print the latency itself.
+			fmt.Printf("%s took less than a second: %t (error: %v)\n", method, time.Since(start) < time.Second, err)
+			return err
+		}
+	}
+
+	c := NewClient(server.URL, nil)
+	c.Interceptors = []Interceptor{logLatency}
+
+	var reply string
+	if err := c.Call("GreetService.Greet", "alice", &reply); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(reply)
+	// Output:
+	// GreetService.Greet took less than a second: true (error: <nil>)
+	// hello, alice
+}
@@ -0,0 +1,46 @@
+package gob
+
+import (
+	"sync/atomic"
+)
+
+// EndpointSelector decides the order in which a Client with several
+// endpoints tries them. A call is sent to the first endpoint in the order,
+// and fails over to the next one whenever the server can't be reached or
+// responds with a 502, 503 or 504 status.
+type EndpointSelector interface {
+	// Order returns the endpoints in the order they should be tried for
+	// a single call. It must not modify endpoints.
+	Order(endpoints []string) []string
+}
+
+// InOrder is an EndpointSelector that always tries endpoints in the order
+// they were given, so later endpoints are only used as fallbacks.
+var InOrder EndpointSelector = inOrder{}
+
+type inOrder struct{}
+
+func (inOrder) Order(endpoints []string) []string {
+	return endpoints
+}
+
+// RoundRobin returns an EndpointSelector that starts each call at the
+// endpoint after the one the previous call started at, spreading calls
+// across all endpoints. It is safe for concurrent use.
+func RoundRobin() EndpointSelector {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (rr *roundRobin) Order(endpoints []string) []string {
+	if len(endpoints) < 2 {
+		return endpoints
+	}
+	start := int((atomic.AddUint64(&rr.next, 1) - 1) % uint64(len(endpoints)))
+	order := make([]string, 0, len(endpoints))
+	order = append(order, endpoints[start:]...)
+	return append(order, endpoints[:start]...)
+}
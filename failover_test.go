@@ -0,0 +1,86 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientFailover(t *testing.T) {
+	var downHits int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	c := NewClientWithEndpoints([]string{down.URL, ts.URL}, nil)
+	for _, s := range []string{"hello", "world"} {
+		var reply string
+		if err := c.Call("SomeService.Echo", s, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != s {
+			t.Errorf("received unexpected response: %s", reply)
+		}
+	}
+	if downHits != 2 {
+		t.Errorf("expected the first endpoint to be tried for every call, got %d hits", downHits)
+	}
+}
+
+func TestClientFailoverAllDown(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	c := NewClientWithEndpoints([]string{down.URL, down.URL}, nil)
+	var reply string
+	err := c.Call("SomeService.Echo", "hello", &reply)
+	var te *TransportError
+	if !errors.As(err, &te) || te.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503 transport error, got %v", err)
+	}
+}
+
+func TestClientFailoverContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var hits int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	c := NewClientWithEndpoints([]string{down.URL, down.URL, ts.URL}, nil)
+	var reply string
+	if err := c.CallContext(ctx, "SomeService.Echo", "hello", &reply); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if hits != 1 {
+		t.Errorf("expected failover to stop once the context was cancelled, got %d hits", hits)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	endpoints := []string{"a", "b", "c"}
+	rr := RoundRobin()
+	for _, want := range [][]string{
+		{"a", "b", "c"},
+		{"b", "c", "a"},
+		{"c", "a", "b"},
+		{"a", "b", "c"},
+	} {
+		if got := rr.Order(endpoints); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+	if !reflect.DeepEqual(endpoints, []string{"a", "b", "c"}) {
+		t.Errorf("endpoints were modified: %v", endpoints)
+	}
+}
@@ -0,0 +1,106 @@
+package gob
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Gateway is an http.Handler that forwards each gob-RPC request it
+// receives to one of several upstream gob-RPC servers, chosen by the
+// method being called, and relays the upstream server's response back to
+// the client unchanged. It lets a single endpoint front services that are
+// served by different backends.
+//
+// Only the method and id are read from a request, so the types of its
+// params don't need to be registered with the gateway, and compressed
+// requests and streams are forwarded as they are. A request that can't
+// be routed, or whose upstream server can't be reached, is answered with
+// a gob-encoded error carrying the request's id.
+type Gateway struct {
+	routes map[string]*url.URL
+	proxy  *httputil.ReverseProxy
+}
+
+// gatewayRequest is what a Gateway knows about a request being proxied.
+type gatewayRequest struct {
+	upstream *url.URL
+	id       uint64
+}
+
+// NewGateway returns a Gateway that routes requests according to routes,
+// which maps a full method name, such as "Users.Get", or a service name,
+// such as "Users", to the URL of the upstream server for it. A method's
+// own entry takes precedence over its service's, and an entry with an
+// empty key, if present, is used for methods with neither. Requests are
+// sent with transport, or http.DefaultTransport if it is nil.
+func NewGateway(routes map[string]string, transport http.RoundTripper) (*Gateway, error) {
+	g := &Gateway{routes: make(map[string]*url.URL, len(routes))}
+	for name, upstream := range routes {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return nil, NewError(fmt.Sprintf("invalid upstream URL for %q: %s", name, err))
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, NewError(fmt.Sprintf("invalid upstream URL for %q: %q is not absolute", name, upstream))
+		}
+		g.routes[name] = u
+	}
+	g.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			target := pr.In.Context().Value(gatewayKey).(*gatewayRequest)
+			u := *target.upstream
+			pr.Out.URL = &u
+			pr.Out.Host = ""
+			pr.SetXForwarded()
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			target := r.Context().Value(gatewayKey).(*gatewayRequest)
+			writeGatewayError(w, http.StatusBadGateway, target.id, NewError(fmt.Sprintf("upstream %s: %s", target.upstream.Host, err)))
+		},
+	}
+	return g, nil
+}
+
+// ServeHTTP forwards r to the upstream server for its method.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method, id, err := peekRequest(r)
+	if err != nil {
+		r.Body.Close()
+		writeErrorResponse(w, http.StatusBadRequest, NewError(fmt.Sprintf("unable to read gob-RPC request: %s", err)))
+		return
+	}
+	upstream := g.route(method)
+	if upstream == nil {
+		r.Body.Close()
+		writeGatewayError(w, http.StatusNotFound, id, NewErrorCode(http.StatusNotFound, fmt.Sprintf("no upstream for method %q", method)))
+		return
+	}
+	ctx := context.WithValue(r.Context(), gatewayKey, &gatewayRequest{upstream: upstream, id: id})
+	g.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// route returns the URL of the upstream server for method, or nil if there
+// is none.
+func (g *Gateway) route(method string) *url.URL {
+	if u, ok := g.routes[method]; ok {
+		return u
+	}
+	if i := strings.Index(method, "."); i >= 0 {
+		if u, ok := g.routes[method[:i]]; ok {
+			return u
+		}
+	}
+	return g.routes[""]
+}
+
+// writeGatewayError writes a gob-encoded error response to the request
+// with the given id.
+func writeGatewayError(w http.ResponseWriter, status int, id uint64, err error) {
+	c := &CodecRequest{codec: &Codec{}, request: &rpcRequest{Id: id}}
+	c.writeServerResponse(w, status, &rpcResponse{Error: err, Id: id})
+}
@@ -0,0 +1,98 @@
+package gob
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway(t *testing.T) {
+	squares, err := NewServer(ServiceReg{Service: &SquareService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := httptest.NewServer(squares)
+	defer upstream.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	g, err := NewGateway(map[string]string{
+		"SomeService":         ts.URL,
+		"SquareService":       upstream.URL,
+		"SomeService.NotHere": down.URL,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(g)
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	var square int
+	if err := c.Call("SquareService.Square", 7, &square); err != nil {
+		t.Fatal(err)
+	}
+	if square != 49 {
+		t.Errorf("expected 49, got %d", square)
+	}
+
+	// Compressed requests are forwarded as is.
+	c.Compressor = Gzip
+	if err := c.Call("SomeService.Echo", "compressed", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "compressed" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+
+	for _, test := range []struct {
+		method string
+		status int
+		want   string
+	}{
+		{"OtherService.Get", http.StatusNotFound, `no upstream for method "OtherService.Get"`},
+		{"SomeService.NotHere", http.StatusBadGateway, "upstream " + strings.TrimPrefix(down.URL, "http://") + ": "},
+	} {
+		message, err := EncodeClientRequestWithID(test.method, nil, 99)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(server.URL, DefaultContentType, bytes.NewReader(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.method, test.status, resp.StatusCode)
+		}
+		id, err := DecodeClientResponseWithID(resp.Body, nil)
+		resp.Body.Close()
+		if id != 99 {
+			t.Errorf("%s: expected the error to carry id 99, got %d", test.method, id)
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: received unexpected error: %v", test.method, err)
+		}
+	}
+
+	err = NewClient(server.URL, nil).Call("OtherService.Get", nil, nil)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != http.StatusNotFound {
+		t.Errorf("expected a 404 *Error, got %v", err)
+	}
+}
+
+func TestNewGatewayInvalidURL(t *testing.T) {
+	if _, err := NewGateway(map[string]string{"SomeService": "/relative"}, nil); err == nil {
+		t.Error("expected an error for a relative upstream URL")
+	}
+}
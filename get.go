@@ -0,0 +1,155 @@
+package gob
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryParam is the query parameter that carries the gob-RPC request of a
+// call made with GET, encoded in unpadded URL-safe base64.
+const QueryParam = "gob"
+
+// getRequestID is the id of every request built by BuildGetRequest. Since
+// the id is part of the URL, a random one would give every call a URL of
+// its own, which no cache would ever hit.
+const getRequestID = 1
+
+// BuildGetRequest is like BuildRequest, but builds a GET request with the
+// gob-RPC request in the URL's QueryParam instead of the body, so that the
+// responses to calls of side-effect free methods can be cached by proxies
+// and CDNs. Each call of a method with the same args gets the same URL,
+// except for args holding maps, which gob doesn't encode in a stable order.
+//
+// Gorilla RPC servers only accept POST, so the server must be wrapped with
+// AllowGET() for the call to succeed. The request isn't compressed, and
+// long args may make the URL too long for a server or proxy to accept.
+func BuildGetRequest(url, method string, args interface{}) (*http.Request, error) {
+	message, err := EncodeClientRequestWithID(method, args, getRequestID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newBodyRequest(context.Background(), url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Method = "GET"
+	q := req.URL.Query()
+	q.Set(QueryParam, base64.RawURLEncoding.EncodeToString(message))
+	req.URL.RawQuery = q.Encode()
+	return req, nil
+}
+
+// queryBody returns a reader for the gob-RPC request carried in the query
+// of r, if it is a GET request that AllowGET() has let through. Other
+// requests are always read from their body, so that a request can't carry
+// a call that AllowGET() hasn't vetted, or one that a signature of its
+// body doesn't cover.
+func queryBody(r *http.Request) (io.Reader, bool) {
+	if allowed, _ := r.Context().Value(getKey).(bool); !allowed {
+		return nil, false
+	}
+	return readQuery(r)
+}
+
+// readQuery returns a reader for the gob-RPC request carried in the query
+// of r, if it has no body and one was sent by BuildGetRequest.
+func readQuery(r *http.Request) (io.Reader, bool) {
+	if r.ContentLength != 0 || r.URL == nil {
+		return nil, false
+	}
+	q := r.URL.Query().Get(QueryParam)
+	if q == "" {
+		return nil, false
+	}
+	return base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(q)), true
+}
+
+// AllowGET returns a handler that lets the named methods be called with GET
+// requests built by BuildGetRequest, by passing them on to h, usually a
+// Gorilla RPC server, as the POST requests it expects. The codec reads the
+// request from the query only for requests passed on this way. Other
+// requests are passed on unchanged.
+//
+// The methods must be free of side effects, since GET requests may be
+// repeated or answered by a cache without reaching the server. GET
+// requests for other methods are rejected with a 405 Method Not Allowed
+// status. If maxAge is positive, successful responses are sent with a
+// Cache-Control header allowing them to be cached for that long, unless
+// one has already been set.
+func AllowGET(h http.Handler, maxAge time.Duration, methods ...string) http.Handler {
+	allowed := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowed[method] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readQuery(r)
+		if r.Method != "GET" || !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		method, _, err := decodeHead("", body)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, NewError(err.Error()))
+			return
+		}
+		if !allowed[method] {
+			writeErrorResponse(w, http.StatusMethodNotAllowed, NewErrorCode(http.StatusMethodNotAllowed, fmt.Sprintf("%s can't be called with GET", method)))
+			return
+		}
+
+		r = r.Clone(context.WithValue(r.Context(), getKey, true))
+		r.Method = "POST"
+		r.Body = http.NoBody
+		if r.Header.Get("Content-Type") == "" {
+			// Some proxies drop the Content-Type of a request without
+			// a body, but Gorilla RPC needs it to pick the codec.
+			r.Header.Set("Content-Type", DefaultContentType)
+		}
+		if maxAge > 0 {
+			w = &cacheControlWriter{ResponseWriter: w, value: "public, max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// cacheControlWriter sets a Cache-Control header on successful responses
+// written through it that don't already have one.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code == http.StatusOK && w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheControlWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheControlWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	flush(w.ResponseWriter)
+}
+
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
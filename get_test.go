@@ -0,0 +1,71 @@
+package gob
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAllowGET(t *testing.T) {
+	server := httptest.NewServer(AllowGET(rs, time.Minute, "SomeService.Echo", "SomeService.Error"))
+	defer server.Close()
+
+	call := func(method string, args, reply interface{}) (*http.Response, error) {
+		req, err := BuildGetRequest(server.URL, method, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Method != "GET" || req.Body != nil {
+			t.Fatalf("expected a GET request without a body, got %s", req.Method)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp, DecodeResponse(resp, reply)
+	}
+
+	var reply string
+	resp, err := call("SomeService.Echo", "hello", &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "public, max-age=60" {
+		t.Errorf("expected the response to be cacheable, got Cache-Control %q", cc)
+	}
+
+	resp, err = call("SomeService.Error", nil, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Error() != "uh-oh" {
+		t.Errorf("expected the method's error, got %v", err)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "" {
+		t.Errorf("expected an error response not to be cacheable, got Cache-Control %q", cc)
+	}
+
+	_, err = call("SomeService.Deadline", nil, nil)
+	var gobErr *Error
+	if !errors.As(err, &gobErr) || gobErr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected a 405 error for a method not allowed with GET, got %v", err)
+	}
+}
+
+func TestBuildGetRequestStableURL(t *testing.T) {
+	a, err := BuildGetRequest("http://localhost/rpc", "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := BuildGetRequest("http://localhost/rpc", "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.URL.String() != b.URL.String() {
+		t.Errorf("expected the same URL for the same call, got %s and %s", a.URL, b.URL)
+	}
+}
@@ -22,40 +22,400 @@ impossible to get any context about the client during an RPC method
 call unless it's provided explicitly each time. Gorilla RPC signatures
 add an *http.Request parameter that can be examined to get this type
 of information.
+
+Registering the Codec
+
+Gorilla RPC selects a codec by the media type of the request's
+Content-Type, ignoring any parameters, so the codec should be registered
+under the bare media type:
+
+	s.RegisterCodec(gob.NewCodec(), "application/gob")
+
+Requests sent with either "application/gob" or "application/gob;
+charset=binary" are then handled by it. Responses are always sent with
+the codec's configured Content-Type, which defaults to the latter.
+
+Registering Types
+
+Params and results are sent as interface values, so any concrete type
+other than the built-in ones that is passed as an argument or returned
+as a result must be registered with encoding/gob on both the client and
+the server, using Register(), RegisterName() or RegisterTypes(). Failing
+to do so typically shows up as an EOF error on the receiving end.
+RegisterCommon() registers common standard library types such as
+time.Time in one go.
+
+Debugging with JSON
+
+A codec with JSONResponses set sends JSON responses to requests that ask
+for them with an Accept header of "application/json". To also accept JSON
+requests, so that a server can be called with curl, register Gorilla's
+json codec alongside this one:
+
+	codec := gob.NewCodec()
+	codec.JSONResponses = true
+	s := rpc.NewServer()
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterCodec(json.NewCodec(), "application/json")
+
+Gorilla dispatches each request to the codec registered for its
+Content-Type, so gob clients are unaffected. A Client with JSON set
+calls methods through the json codec in the same way, for clients that
+can't use gob.
 */
 package gob
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
+	"io/ioutil"
+	mathrand "math/rand"
+	"mime"
 	"net/http"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/rpc/v2"
 )
 
+// DefaultContentType is the Content-Type of gob-RPC requests and responses
+// unless another one is configured.
+const DefaultContentType = "application/gob; charset=binary"
+
 // NewCodec returns a new gob codec to register with a Gorilla RPC server.
 func NewCodec() *Codec {
 	return &Codec{}
 }
 
+// NewCodecWithContentType returns a new gob codec that sets the given
+// Content-Type on its responses, for use when registering the codec under
+// a media type other than "application/gob", such as a vendor-specific or
+// versioned one.
+func NewCodecWithContentType(contentType string) *Codec {
+	return &Codec{ContentType: contentType}
+}
+
+// Codec is a Gorilla RPC codec for gob-encoded requests and responses.
+//
+// A Codec is safe for concurrent use by multiple goroutines, as a server
+// requires, provided that its fields aren't changed once it's registered.
+// The state of each request is held in the CodecRequest created for it,
+// and the only state shared between requests, a pool of encoding buffers,
+// is synchronized. The functions and Observer set on a Codec may be called
+// concurrently, so they must be safe for concurrent use too.
 type Codec struct {
+	// ContentType is the Content-Type set on responses. If empty,
+	// DefaultContentType is used.
+	ContentType string
+
+	// MaxRequestBytes is the maximum size of a request body, after any
+	// decompression. Larger requests are rejected with an error. A value of
+	// zero means no limit.
+	MaxRequestBytes int64
+
+	// ReadTimeout, if positive, is how long a client has to send the body
+	// of a request, measured from when the codec starts reading it. If the
+	// body is still arriving after that, the request is rejected with an
+	// error. The timeout is only checked before each read of the body, so
+	// a read that is waiting for a slow client isn't interrupted; wrap the
+	// server with ReadTimeout() to cut such clients off.
+	ReadTimeout time.Duration
+
+	// Compressors lists the compressors that may be used for responses, in
+	// order of preference. The first one accepted by the client, according
+	// to its Accept-Encoding header, is used. If nil, only Gzip is used.
+	// Requests compressed with any of the built-in compressors are always
+	// accepted.
+	Compressors []Compressor
+
+	// Strict causes a request to be rejected with a "schema mismatch"
+	// error if the client's type for its params doesn't have the same
+	// fields as the server's type it was decoded into, which gob otherwise
+	// tolerates by dropping fields the server doesn't know about and
+	// leaving those the client didn't send at their zero values. The
+	// comparison covers fields nested at any depth, but ignores type names
+	// and the sizes of numbers, which gob doesn't care about either.
+	//
+	// Clients send a hash of their params type with every request for
+	// this purpose. Requests without one, such as those from clients built
+	// with an older version of this package, aren't checked.
+	Strict bool
+
+	// MethodTimeouts, if non-nil, maps method names, such as
+	// "Reports.Generate", to the longest that a call to each may take.
+	// The request context seen by the method is given a matching deadline,
+	// unless the client's own deadline comes sooner, and a call that is
+	// still running once it passes gets an error with a code of 504,
+	// sent with the same HTTP status, instead of its result. Methods that
+	// run for long should watch the context so that they stop once it's
+	// done.
+	MethodTimeouts map[string]time.Duration
+
+	// GzipLevel is the level at which responses are compressed when Gzip
+	// is used, from gzip.HuffmanOnly or gzip.BestSpeed to
+	// gzip.BestCompression. Zero, like any invalid level, means
+	// gzip.DefaultCompression. Services that are short of CPU rather than
+	// bandwidth may prefer gzip.BestSpeed.
+	GzipLevel int
+
+	// StreamResponses causes responses to be encoded directly to the
+	// http.ResponseWriter instead of being buffered in memory first, which
+	// reduces memory usage for methods that return large results.
+	//
+	// The tradeoff is that if encoding fails partway through, the bytes
+	// already written can't be taken back, so the client receives a
+	// truncated response rather than an error describing what went wrong.
+	StreamResponses bool
+
+	// Observer, if non-nil, is notified as requests are decoded and
+	// responses are written.
+	Observer Observer
+
+	// OnBytes, if non-nil, is called once the response to each request
+	// has been written, with the number of bytes of the request body that
+	// were read and the number of bytes of the response body, both as
+	// sent over the wire, after any compression. It's meant for
+	// accounting for the traffic of each call, such as for billing. The
+	// method is empty if the request couldn't be decoded. A call made
+	// with GET is counted by the length of its query parameter instead,
+	// which is the request encoded in base64.
+	OnBytes func(method string, in, out int)
+
+	// OnDecodeError, if non-nil, is called when a request can't be
+	// decoded, such as when a client sends a malformed body.
+	OnDecodeError func(err error)
+
+	// OnEncodeError, if non-nil, is called when a response can't be
+	// encoded, such as when a result contains an unregistered type. It is
+	// also called when an error returned by a method can't be encoded, in
+	// which case it is sent to the client as an *Error with the same
+	// message and code instead.
+	OnEncodeError func(err error)
+
+	// IncludePanicStack causes the stack trace to be captured when a panic
+	// is recovered by the codec or by a handler created with Recover(), so
+	// that it can be logged by OnPanic. The stack is never sent to clients.
+	IncludePanicStack bool
+
+	// OnPanic, if non-nil, is called when a panic is recovered by the codec
+	// or by a handler created with Recover().
+	OnPanic func(err *PanicError)
+
+	// TraceExtractor, if non-nil, is called with the context and headers
+	// of each request, and returns the context that is used for the rest of
+	// the request. It is the server side counterpart to TraceInjector, and
+	// is typically used to extract a W3C traceparent header with a tracing
+	// library's propagator, without this package depending on one.
+	TraceExtractor func(ctx context.Context, header http.Header) context.Context
+
+	// JSONResponses, if true, causes responses to be encoded as JSON
+	// instead of gob for requests whose Accept header prefers
+	// "application/json", which is handy for debugging a server with
+	// tools like curl. Errors are sent as their message only. See the
+	// package documentation for how to accept JSON requests too.
+	JSONResponses bool
+
+	// Authorizer, if non-nil, is called with each decoded request and the
+	// name of the method it calls, before the method is invoked. If it
+	// returns an error, the method isn't invoked, and the error is sent to
+	// the client with a 403 Forbidden status. Errors other than an *Error
+	// are sent as an *Error with a code of 403.
+	Authorizer func(r *http.Request, method string) error
+}
+
+// ErrForbidden is a convenient error for a Codec's Authorizer to return
+// when a request isn't allowed to call the method.
+var ErrForbidden = NewErrorCode(http.StatusForbidden, "forbidden")
+
+// mediaType returns the media type of the given Content-Type in lower
+// case, without any parameters.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mt
+}
+
+func (c *Codec) compressors() []Compressor {
+	if c.Compressors == nil {
+		return []Compressor{Gzip}
+	}
+	return c.Compressors
+}
+
+// compressor returns the compressor to use for a response to r, if any.
+func (c *Codec) compressor(r *http.Request) Compressor {
+	comp := negotiateCompressor(r, c.compressors())
+	if comp == Gzip && c.GzipLevel != 0 {
+		return gzipWithLevel(c.GzipLevel)
+	}
+	return comp
+}
+
+func (c *Codec) contentType() string {
+	if c.ContentType == "" {
+		return DefaultContentType
+	}
+	return c.ContentType
 }
 
 func (c *Codec) NewRequest(r *http.Request) rpc.CodecRequest {
-	req := new(rpcRequest)
-	err := gob.NewDecoder(r.Body).Decode(req)
-	r.Body.Close()
-	return &CodecRequest{request: req, err: err}
+	start := time.Now()
+	var (
+		req = new(rpcRequest)
+		dec *gob.Decoder
+	)
+	in := &countingReader{ReadCloser: r.Body}
+	r.Body = in
+	if _, ok := queryBody(r); ok {
+		in.n = len(r.URL.Query().Get(QueryParam))
+	}
+	body, err := requestBody(r)
+	if err == nil && c.MaxRequestBytes > 0 && r.ContentLength > c.MaxRequestBytes && r.Header.Get("Content-Encoding") == "" {
+		// The body is known to be too large without having to read it.
+		err = NewError(fmt.Sprintf("request body too large: limit is %d bytes", c.MaxRequestBytes))
+	} else if err == nil {
+		if c.ReadTimeout > 0 {
+			body = &timeoutReader{r: body, timeout: c.ReadTimeout, deadline: start.Add(c.ReadTimeout)}
+		}
+		if c.MaxRequestBytes > 0 {
+			body = http.MaxBytesReader(nil, ioutil.NopCloser(body), c.MaxRequestBytes)
+		}
+		dec = gob.NewDecoder(body)
+		err = readTimeoutError(sizeLimitError(dec.Decode(req)))
+		if err == io.EOF {
+			err = NewError("empty gob-RPC request body")
+		} else if err == nil {
+			err = checkMethod(req.Method)
+		}
+	}
+	if err != nil || !req.Stream {
+		// The params of a streamed request are read by the method, and
+		// the body is closed by net/http once it returns.
+		r.Body.Close()
+	}
+	if err != nil && c.OnDecodeError != nil {
+		c.OnDecodeError(err)
+	}
+	cr := &CodecRequest{codec: c, request: req, err: err, compressor: c.compressor(r), start: start, in: in}
+	cr.json = c.JSONResponses && prefersJSON(r.Header.Get("Accept"))
+	if err == nil && req.Stream {
+		cr.stream = dec
+	}
+	if err == nil {
+		ctx := context.WithValue(r.Context(), requestIDKey, req.Id)
+		if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+			ctx = context.WithValue(ctx, idempotencyKey, key)
+		}
+		if c.TraceExtractor != nil {
+			ctx = c.TraceExtractor(ctx, r.Header)
+		}
+		if timeout, ok := deadlineFromHeader(r); ok {
+			ctx, cr.cancel = context.WithTimeout(ctx, timeout)
+		}
+		if timeout := c.MethodTimeouts[req.Method]; timeout > 0 {
+			if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > timeout {
+				var cancel func()
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				if prev := cr.cancel; prev != nil {
+					cr.cancel = func() { cancel(); prev() }
+				} else {
+					cr.cancel = cancel
+				}
+				cr.timeout, cr.ctx = timeout, ctx
+			}
+		}
+		setContext(r, ctx)
+		if c.Observer != nil {
+			c.Observer.RequestDecoded(req.Method)
+		}
+		if c.Authorizer != nil {
+			if err := c.Authorizer(r, req.Method); err != nil {
+				if _, ok := err.(*Error); !ok {
+					err = NewErrorCode(http.StatusForbidden, err.Error())
+				}
+				cr.err, cr.forbidden = err, true
+			}
+		}
+	}
+	return cr
+}
+
+// timeoutReader is an io.Reader whose reads fail once its deadline has
+// passed. A read that has already started isn't interrupted.
+type timeoutReader struct {
+	r        io.Reader
+	timeout  time.Duration
+	deadline time.Time
+}
+
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	if time.Now().After(t.deadline) {
+		return 0, NewError(fmt.Sprintf("request body not received within %s", t.timeout))
+	}
+	return t.r.Read(p)
+}
+
+// sizeLimitError replaces an error from reading past a request body's size
+// limit with one that can be sent back to the client.
+func sizeLimitError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return NewError(fmt.Sprintf("request body too large: limit is %d bytes", tooLarge.Limit))
+	}
+	return err
+}
+
+// checkMethod returns an error if method isn't of the form
+// "Service.Method" expected by Gorilla RPC.
+func checkMethod(method string) error {
+	i := strings.IndexByte(method, '.')
+	if i <= 0 || i == len(method)-1 || strings.IndexByte(method[i+1:], '.') >= 0 {
+		return NewError(fmt.Sprintf("invalid method name %q: must be of the form \"Service.Method\"", method))
+	}
+	return nil
 }
 
 type CodecRequest struct {
+	codec   *Codec
 	request *rpcRequest
 	err     error
+	start   time.Time // when decoding of the request began
+	in      *countingReader
+	cancel  func()    // releases the request's context, if non-nil
+
+	// timeout is the timeout for the method from the codec's
+	// MethodTimeouts, if it applies, in which case ctx is the context with
+	// its deadline.
+	timeout time.Duration
+	ctx     context.Context
+
+	// read and readFailed record whether ReadRequest has been called, and
+	// whether it failed, for choosing the status of an error response.
+	read, readFailed bool
+
+	// forbidden records that the codec's Authorizer rejected the request.
+	forbidden bool
+
+	// compressor is used to compress the response, if non-nil.
+	compressor Compressor
+
+	// stream decodes the params of a streamed request.
+	stream *gob.Decoder
+
+	// json records that the response should be encoded as JSON.
+	json bool
 }
 
 func (c *CodecRequest) Method() (string, error) {
@@ -66,11 +426,15 @@ func (c *CodecRequest) Method() (string, error) {
 }
 
 func (c *CodecRequest) ReadRequest(args interface{}) (err error) {
+	defer func() { c.read, c.readFailed = true, err != nil }()
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
 				panic(r)
 			}
+			if c.codec.OnPanic != nil {
+				c.codec.OnPanic(newPanicError(r, c.codec.IncludePanicStack))
+			}
 			switch t := r.(type) {
 			case error:
 				err = t
@@ -82,97 +446,698 @@ func (c *CodecRequest) ReadRequest(args interface{}) (err error) {
 		}
 	}()
 
-	if c.err == nil && c.request.Params != nil {
+	if stream, ok := args.(*Stream); ok && stream != nil {
+		if c.err == nil && !c.request.Stream {
+			return NewError("invalid parameter: expected a stream, but got a single value")
+		}
+		stream.dec = c.stream
+		return c.err
+	}
+	if c.err == nil && !c.request.Stream && assignScalar(args, c.request.Params) {
+		return nil
+	}
+	if c.err == nil && (c.request.Params != nil || c.request.Stream) {
+		if !isNonNilPointer(args) {
+			return NewError(fmt.Sprintf("invalid args: must be a non-nil pointer, not %T", args))
+		}
+		if c.request.Stream {
+			return NewError(fmt.Sprintf("invalid parameter: expected %s, but got a stream", reflect.TypeOf(args).Elem()))
+		}
 		var (
 			va = reflect.ValueOf(args).Elem()
 			vb = reflect.ValueOf(c.request.Params)
 		)
-		if !vb.Type().AssignableTo(va.Type()) {
-			return NewError(fmt.Sprintf("invalid parameter: expected %s, but got %s", va.Type().Name(), vb.Type().Name()))
+		if !assign(va, vb) {
+			return NewError(fmt.Sprintf("invalid parameter: expected %s, but got %s", va.Type(), vb.Type()))
+		}
+		if c.codec.Strict && c.request.Schema != 0 && c.request.Schema != schemaOf(c.request.Params) {
+			return NewError(fmt.Sprintf("schema mismatch: the client's params don't have the same fields as %s", vb.Type()))
 		}
-		va.Set(vb)
 	}
 
 	return c.err
 }
 
 func (c *CodecRequest) WriteResponse(w http.ResponseWriter, reply interface{}) {
+	if err := c.timeoutError(); err != nil {
+		c.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cw := &countingWriter{ResponseWriter: w}
 	// A request id of 0 is a notification and needs no response.
-	if c.request.Id != 0 {
-		c.writeServerResponse(w, http.StatusOK, &rpcResponse{
+	if raw, ok := reply.(*RawResult); ok && raw != nil && c.request.Id != 0 {
+		raw.writeTo(cw)
+	} else if c.request.Id != 0 {
+		c.writeServerResponse(cw, http.StatusOK, &rpcResponse{
 			Result: reply,
 			Error:  nil,
 			Id:     c.request.Id,
 		})
+	} else {
+		cw.WriteHeader(http.StatusNoContent)
 	}
+	c.observe(nil, cw.n)
 }
 
+// WriteError writes err to w as a gob-encoded error response. The HTTP
+// status reflects how far the request got before failing: 400 Bad Request
+// if it couldn't be decoded, 403 Forbidden if the codec's Authorizer
+// rejected it, 404 Not Found if the method doesn't exist, and 504 Gateway
+// Timeout if the method ran past its timeout. If the method itself
+// returned an error, the status is the Code of the *Error found in it by
+// errors.As, if that is from 400 to 599, and 500 Internal Server Error
+// otherwise. A method that returns a 502 or 503 error will be retried by a
+// Client with more than one endpoint, as with any other unavailable
+// server. If the method returned ErrResponseHandled, nothing is written.
 func (c *CodecRequest) WriteError(w http.ResponseWriter, _ int, err error) {
-	c.writeServerResponse(w, http.StatusBadRequest, &rpcResponse{
+	if errors.Is(err, ErrResponseHandled) {
+		c.observe(nil, 0)
+		return
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	status := c.errorStatus()
+	if status == http.StatusInternalServerError {
+		if terr := c.timeoutError(); terr != nil {
+			err = terr
+		}
+		var e *Error
+		if errors.As(err, &e) && e.Code >= 400 && e.Code <= 599 {
+			status = e.Code
+		}
+	} else if _, ok := err.(*Error); !ok {
+		// Errors from before the method was called come from gob or
+		// Gorilla RPC, whose error types aren't registered with gob.
+		err = NewError(err.Error())
+	}
+	c.writeServerResponse(cw, status, &rpcResponse{
 		Result: nil,
 		Error:  err,
 		Id:     c.request.Id,
 	})
+	c.observe(err, cw.n)
+}
+
+// timeoutError returns the error to send in place of the outcome of the
+// method if it ran for longer than its timeout, or nil if it didn't.
+func (c *CodecRequest) timeoutError() error {
+	if c.timeout == 0 || c.ctx.Err() != context.DeadlineExceeded {
+		return nil
+	}
+	return NewErrorCode(http.StatusGatewayTimeout, fmt.Sprintf("%s timed out after %s", c.request.Method, c.timeout))
+}
+
+// errorStatus returns the HTTP status for an error response to c. Gorilla
+// RPC always passes 400 to WriteError, so the status is worked out from
+// which of the codec's methods it has already called: the method is looked
+// up after calling Method and before calling ReadRequest.
+func (c *CodecRequest) errorStatus() int {
+	switch {
+	case c.forbidden:
+		return http.StatusForbidden
+	case c.err != nil || c.readFailed:
+		return http.StatusBadRequest
+	case !c.read:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// observe notifies the codec's observer and OnBytes, if any, that a
+// response of the given size has been written. It is called once the
+// request is finished, so it also releases the request's context.
+func (c *CodecRequest) observe(err error, bytes int) {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.codec.Observer != nil {
+		c.codec.Observer.ResponseWritten(c.request.Method, err, bytes, time.Since(c.start))
+	}
+	if c.codec.OnBytes != nil {
+		c.codec.OnBytes(c.request.Method, c.in.n, bytes)
+	}
 }
 
 func (c *CodecRequest) writeServerResponse(w http.ResponseWriter, status int, res *rpcResponse) {
-	var buf bytes.Buffer
-	if err := gob.NewEncoder(&buf).Encode(res); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if c.codec.JSONResponses {
+		w.Header().Add("Vary", "Accept")
+	}
+	if c.json {
+		c.writeJSONResponse(w, status, res)
+		return
+	}
+	w.Header().Set("Content-Type", c.codec.contentType())
+	if res.Error != nil {
+		if err := checkEncodable(res.Error); err != nil {
+			// Rather than failing the whole response, send what the
+			// client can decode: the message and code of the error.
+			if c.codec.OnEncodeError != nil {
+				c.codec.OnEncodeError(fmt.Errorf("%w%s", err, encodeHint(err, res.Error)))
+			}
+			res = &rpcResponse{Error: coerceError(res.Error), Id: res.Id}
+		}
+	}
 
-		var hint string
-		if err.Error() == "gob: type not registered for interface: errors.errorString" {
-			hint = " (hint: use gob.NewError() instead)"
+	if c.codec.StreamResponses {
+		c.streamServerResponse(w, status, res)
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := gob.NewEncoder(buf).Encode(res); err != nil {
+		if c.codec.OnEncodeError != nil {
+			c.codec.OnEncodeError(err)
 		}
 
 		// The result couldn't be encoded, so send a value that we know
 		// will succeed so that the client knows what happened.
-		gob.NewEncoder(w).Encode(&rpcResponse{
+		buf.Reset()
+		gob.NewEncoder(buf).Encode(&rpcResponse{
 			Result: nil,
-			Error:  NewError(err.Error() + hint),
+			Error:  NewError(err.Error() + encodeHint(err, res.Error)),
 			Id:     res.Id,
 		})
+		writeBuffered(w, http.StatusInternalServerError, buf)
 		return
 	}
 
+	w.Header().Add("Vary", "Accept-Encoding")
+	if c.compressor != nil {
+		zbuf := getBuffer()
+		defer putBuffer(zbuf)
+		if err := compressTo(zbuf, buf.Bytes(), c.compressor); err == nil {
+			w.Header().Set("Content-Encoding", c.compressor.Encoding())
+			buf = zbuf
+		}
+	}
+
+	writeBuffered(w, status, buf)
+}
+
+// writeBuffered writes buf to w as the body of a response with the given
+// status. The response is flushed so that it isn't held up by a buffer on
+// the way, and given a Content-Length so that doing so doesn't cause it to
+// be sent chunked.
+func writeBuffered(w http.ResponseWriter, status int, buf *bytes.Buffer) {
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
 	w.WriteHeader(status)
-	w.Header().Set("Content-Type", "application/gob; charset=binary")
-	io.Copy(w, &buf)
+	io.Copy(w, buf)
+	flush(w)
 }
 
+// coerceError returns an *Error with the message of err, and its code if
+// it is an *Error, for sending in place of an error that can't be encoded.
+func coerceError(err error) error {
+	var code int
+	if e, ok := err.(*Error); ok {
+		code = e.Code
+	}
+	return NewErrorCode(code, err.Error())
+}
+
+// writeErrorResponse writes a gob-encoded error response for a request that
+// was rejected before it could be decoded, so its id is unknown.
+func writeErrorResponse(w http.ResponseWriter, status int, err error) {
+	c := &CodecRequest{codec: &Codec{}, request: new(rpcRequest)}
+	c.writeServerResponse(w, status, &rpcResponse{Error: err})
+}
+
+// encodeHint returns a suggestion for fixing the given encoding error of a
+// message, to be appended to its message, or an empty string if there isn't
+// one. For a response, rpcErr is the error it carries, if any.
+func encodeHint(err, rpcErr error) string {
+	name, ok := unregisteredType(err)
+	if !ok {
+		return ""
+	}
+	if rpcErr != nil && name == baseType(rpcErr).String() {
+		if isStandardType(baseType(rpcErr)) {
+			return " (hint: use gob.NewError() instead)"
+		}
+		return fmt.Sprintf(" (hint: register the error type %T with gob.RegisterError())", rpcErr)
+	}
+	if strings.HasPrefix(name, "errors.") || strings.HasPrefix(name, "fmt.") {
+		// An error from the standard library held by another error.
+		return " (hint: use gob.NewError() instead)"
+	}
+	return fmt.Sprintf(" (hint: register %s with gob.Register() on both ends)", name)
+}
+
+// encodeError adds a suggestion for fixing err, an error from encoding a
+// request, if there is one. gob's own errors leave it to the reader to
+// work out that a value held in an interface, possibly deep inside the
+// params, is of a type that was never registered.
+func encodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if hint := encodeHint(err, nil); hint != "" {
+		return NewError(err.Error() + hint)
+	}
+	return err
+}
+
+// unregisteredType returns the name of the type that gob reported as not
+// being registered in err, if that's what err is about. gob names it by
+// its package name and type name, with any pointers removed.
+func unregisteredType(err error) (string, bool) {
+	const marker = "type not registered for interface: "
+	msg := err.Error()
+	i := strings.Index(msg, marker)
+	if i < 0 {
+		return "", false
+	}
+	return msg[i+len(marker):], true
+}
+
+// isStandardType reports whether rt is defined in the standard library,
+// going by the convention that only its import paths lack a dot in their
+// first element.
+func isStandardType(rt reflect.Type) bool {
+	path := rt.PkgPath()
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return path != "" && !strings.Contains(path, ".")
+}
+
+// baseType returns the type of v with any pointers removed, which is how
+// gob names a type in its errors.
+func baseType(v interface{}) reflect.Type {
+	rt := reflect.TypeOf(v)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return rt
+}
+
+// streamServerResponse encodes res directly to w, without buffering it.
+// Encoding errors can't be reported to the client once writing has begun.
+func (c *CodecRequest) streamServerResponse(w http.ResponseWriter, status int, res *rpcResponse) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if c.compressor != nil {
+		w.Header().Set("Content-Encoding", c.compressor.Encoding())
+	}
+	w.WriteHeader(status)
+
+	var err error
+	if c.compressor != nil {
+		zw := c.compressor.NewWriter(w)
+		err = gob.NewEncoder(zw).Encode(res)
+		zw.Close()
+	} else {
+		err = gob.NewEncoder(w).Encode(res)
+	}
+	if err != nil && c.codec.OnEncodeError != nil {
+		c.codec.OnEncodeError(err)
+	}
+	flush(w)
+}
+
+// bufferPool holds buffers for encoding messages, to cut down on
+// allocations when handling many requests.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// maxPooledBuffer is the largest buffer capacity that will be returned to
+// bufferPool, so that one unusually large message doesn't pin its memory.
+const maxPooledBuffer = 64 << 10
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// IDGenerator is called by EncodeClientRequest to generate the id of each
+// request. It defaults to a random id, and may be replaced for tests or by
+// applications that want sequential ids. It must never return zero, which
+// is reserved for notifications.
+var IDGenerator func() uint64 = newRequestID
+
+// Rand, if non-nil, is the source of the ids generated by the default
+// IDGenerator, instead of crypto/rand. Setting it to a seeded source makes
+// the ids of a test reproducible. Access to it is synchronized by this
+// package, so it must not be used elsewhere.
+var Rand *mathrand.Rand
+
+// randMu serializes use of Rand, which isn't safe for concurrent use.
+var randMu sync.Mutex
+
 // EncodeClientRequest encodes parameters for a gob-RPC client request.
 func EncodeClientRequest(method string, args interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(&rpcRequest{
+	return EncodeClientRequestWithID(method, args, IDGenerator())
+}
+
+// EncodeClientRequestWithID is like EncodeClientRequest, but uses the given
+// request id instead of generating one. The id must be non-zero.
+func EncodeClientRequestWithID(method string, args interface{}, id uint64) ([]byte, error) {
+	if id == 0 {
+		return nil, NewError("invalid request id: must be non-zero")
+	}
+	return encodeRequest(method, args, id)
+}
+
+// EncodeNotification encodes parameters for a gob-RPC notification, which
+// is a request with an id of zero. The server invokes the method as usual,
+// but responds with 204 No Content and an empty body unless the call fails.
+func EncodeNotification(method string, args interface{}) ([]byte, error) {
+	return encodeRequest(method, args, 0)
+}
+
+// WriteClientRequest is like EncodeClientRequest, but writes the encoded
+// request straight to w instead of returning it, such as to a pipe feeding
+// an HTTP request body or to a compressing writer. If encoding fails, part
+// of the request may already have been written.
+func WriteClientRequest(w io.Writer, method string, args interface{}) error {
+	return writeRequest(w, method, args, IDGenerator())
+}
+
+// EncodeClientRequestTo is like EncodeClientRequest, but replaces the
+// contents of buf with the encoded request instead of allocating a new
+// slice, so that a client sending many requests can reuse its buffers.
+// The encoded request is only valid until buf is next modified. If
+// encoding fails, buf may hold part of the request.
+func EncodeClientRequestTo(buf *bytes.Buffer, method string, args interface{}) error {
+	buf.Reset()
+	return writeRequest(buf, method, args, IDGenerator())
+}
+
+func encodeRequest(method string, args interface{}, id uint64) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := writeRequest(buf, method, args, id); err != nil {
+		return nil, err
+	}
+
+	// The buffer goes back into the pool, so the caller needs a copy.
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+func writeRequest(w io.Writer, method string, args interface{}, id uint64) error {
+	return encodeError(gob.NewEncoder(w).Encode(&rpcRequest{
 		Method: method,
 		Params: args,
-		Id:     uint64(rand.Int63()) + 1, // ensure a non-zero id
-	})
-	return buf.Bytes(), err
+		Id:     id,
+		Schema: schemaOf(args),
+	}))
+}
+
+// newRequestID returns a random request id. Zero is reserved for
+// notifications, so it is never returned.
+func newRequestID() uint64 {
+	randMu.Lock()
+	if Rand != nil {
+		defer randMu.Unlock()
+		for {
+			if id := Rand.Uint64(); id != 0 {
+				return id
+			}
+		}
+	}
+	randMu.Unlock()
+
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic("gob: unable to generate request id: " + err.Error())
+		}
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id
+		}
+	}
 }
 
 // BuildRequest builds an HTTP request for calling a gob-RPC method.
 //
 // The body of the request is created using EncodeClientRequest(), the
-// verb is set to POST, and the Content-Type header is set to
-// "application/gob; charset=binary".
+// verb is set to POST, the Content-Type header is set to
+// "application/gob; charset=binary", and ContentLength is set to the
+// length of the encoded request.
 func BuildRequest(url, method string, args interface{}) (*http.Request, error) {
+	return BuildRequestWithContext(context.Background(), url, method, args)
+}
+
+// BuildRequestWithContext is like BuildRequest, but attaches ctx to the
+// returned request so that the call can be cancelled or given a deadline.
+// If ctx has a deadline, it is also sent to the server in the
+// X-Gob-RPC-Deadline header.
+func BuildRequestWithContext(ctx context.Context, url, method string, args interface{}) (*http.Request, error) {
 	message, err := EncodeClientRequest(method, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return newRequest(ctx, url, message)
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(message))
+// BuildRequestWithHeaders is like BuildRequest, but also sets the given
+// headers on the request, such as an authorization token or tenant id for
+// this particular call. Each header replaces any value the request would
+// otherwise have, except for Content-Type and Content-Encoding, which
+// describe the body and can't be overridden.
+func BuildRequestWithHeaders(url, method string, args interface{}, header http.Header) (*http.Request, error) {
+	req, err := BuildRequest(url, method, args)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	setHeaders(req, header)
+	return req, nil
+}
 
-	req.Header.Set("Content-Type", "application/gob; charset=binary")
+// setHeaders sets each of header on req, other than those describing its
+// body.
+func setHeaders(req *http.Request, header http.Header) {
+	for key, values := range header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Type", "Content-Encoding":
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+}
+
+// newRequest builds an HTTP request for sending an encoded gob-RPC message.
+func newRequest(ctx context.Context, url string, message []byte) (*http.Request, error) {
+	req, err := newBodyRequest(ctx, url, bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	// net/http would set these for a *bytes.Reader body itself, but a
+	// redirected call depends on GetBody, so it's not left to chance.
+	req.ContentLength = int64(len(message))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(message)), nil
+	}
 	return req, nil
 }
 
+// newBodyRequest builds an HTTP request for sending a gob-RPC message that
+// is read from body.
+func newBodyRequest(ctx context.Context, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", DefaultContentType)
+	if header, ok := ctx.Value(headersKey).(http.Header); ok {
+		setHeaders(req, header)
+	}
+	setDeadlineHeader(req, ctx)
+	if TraceInjector != nil {
+		TraceInjector(ctx, req.Header)
+	}
+	return req, nil
+}
+
+// TraceInjector, if non-nil, is called with the context and headers of
+// every request built by this package, so that trace context can be
+// propagated to the server, such as by a tracing library's propagator
+// setting a W3C traceparent header. See Codec.TraceExtractor for the
+// server side.
+var TraceInjector func(ctx context.Context, header http.Header)
+
 // DecodeClientResponse decodes the response body of a client request into the interface reply.
-func DecodeClientResponse(r io.Reader, reply interface{}) (err error) {
+// Since it only sees the body, an error response that isn't gob-encoded,
+// such as one from a proxy, fails with a gob decoding error. DecodeResponse
+// takes the whole *http.Response and reports those more clearly.
+func DecodeClientResponse(r io.Reader, reply interface{}) error {
+	_, err := DecodeClientResponseWithID(r, reply)
+	return err
+}
+
+// DecodeClientResponseWithID is like DecodeClientResponse, but also returns
+// the id of the response so that it can be matched to the request that
+// produced it. The id is returned even if the response carries an error,
+// but is zero if the response couldn't be decoded at all.
+func DecodeClientResponseWithID(r io.Reader, reply interface{}) (uint64, error) {
+	var res rpcResponse
+	if err := gob.NewDecoder(r).Decode(&res); err != nil {
+		return 0, err
+	}
+	return res.Id, res.decode(reply)
+}
+
+// DecodeClientResponseValue is like DecodeClientResponse, but returns the
+// result as it was decoded instead of storing it in a reply, for clients
+// and tools that don't know the type of the result in advance. The result
+// has the concrete type that the server sent, which, as for any result,
+// must have been registered with Register() on the client too, or
+// decoding fails with an error naming the type. A method with no result
+// yields a nil value.
+func DecodeClientResponseValue(r io.Reader) (interface{}, error) {
+	var res rpcResponse
+	if err := gob.NewDecoder(r).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return res.Result, nil
+}
+
+// DecodeClientResponseContext is like DecodeClientResponse, but gives up
+// once ctx is done, returning ctx.Err(), even if the response is still
+// being read. If r is an io.Closer, such as the body of an
+// *http.Response, it's closed then, which unblocks the read in progress;
+// otherwise the read continues in the background until r returns, but
+// reply is left untouched.
+func DecodeClientResponseContext(ctx context.Context, r io.Reader, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	type decoded struct {
+		res rpcResponse
+		err error
+	}
+	done := make(chan *decoded, 1)
+	go func() {
+		d := new(decoded)
+		d.err = gob.NewDecoder(r).Decode(&d.res)
+		done <- d
+	}()
+
+	select {
+	case d := <-done:
+		if d.err != nil {
+			return d.err
+		}
+		return d.res.decode(reply)
+	case <-ctx.Done():
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// assign stores v in dst, reporting whether their types allow it. Whether
+// a value arrives as a pointer depends on how its type was registered, so
+// if it doesn't match dst directly, one level of pointer is removed from or
+// added to v if that makes it match.
+func assign(dst, v reflect.Value) bool {
+	vt, dt := v.Type(), dst.Type()
+	switch {
+	case vt.AssignableTo(dt):
+		dst.Set(v)
+	case vt.Kind() == reflect.Ptr && vt.Elem().AssignableTo(dt):
+		if v.IsNil() {
+			dst.Set(reflect.Zero(dt))
+		} else {
+			dst.Set(v.Elem())
+		}
+	case dt.Kind() == reflect.Ptr && vt.AssignableTo(dt.Elem()):
+		p := reflect.New(dt.Elem())
+		p.Elem().Set(v)
+		dst.Set(p)
+	default:
+		return false
+	}
+	return true
+}
+
+// assignScalar stores v in *dst without using reflection when dst is a
+// non-nil pointer to one of the basic types and v has exactly that type,
+// which is the common case for small methods. It reports whether it did so,
+// and otherwise leaves dst untouched.
+func assignScalar(dst, v interface{}) bool {
+	switch p := dst.(type) {
+	case *string:
+		if x, ok := v.(string); ok && p != nil {
+			*p = x
+			return true
+		}
+	case *int:
+		if x, ok := v.(int); ok && p != nil {
+			*p = x
+			return true
+		}
+	case *int64:
+		if x, ok := v.(int64); ok && p != nil {
+			*p = x
+			return true
+		}
+	case *uint64:
+		if x, ok := v.(uint64); ok && p != nil {
+			*p = x
+			return true
+		}
+	case *float64:
+		if x, ok := v.(float64); ok && p != nil {
+			*p = x
+			return true
+		}
+	case *bool:
+		if x, ok := v.(bool); ok && p != nil {
+			*p = x
+			return true
+		}
+	case *[]byte:
+		if x, ok := v.([]byte); ok && p != nil {
+			*p = x
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseDecoder decodes a sequence of gob-RPC responses written one after
+// another to the same reader, such as by a server that writes several
+// responses to one connection.
+type ResponseDecoder struct {
+	dec *gob.Decoder
+}
+
+// NewResponseDecoder returns a ResponseDecoder that reads from r.
+func NewResponseDecoder(r io.Reader) *ResponseDecoder {
+	return &ResponseDecoder{dec: gob.NewDecoder(r)}
+}
+
+// Decode decodes the next response into reply, and returns its id as
+// DecodeClientResponseWithID does. Once every response has been read, it
+// returns io.EOF. An error returned by the remote method leaves the decoder
+// positioned at the next response, so decoding can continue.
+func (d *ResponseDecoder) Decode(reply interface{}) (uint64, error) {
+	var res rpcResponse
+	if err := d.dec.Decode(&res); err != nil {
+		return 0, err
+	}
+	return res.Id, res.decode(reply)
+}
+
+// decode stores the result of the response in reply, or returns the
+// response's error if it has one.
+func (res *rpcResponse) decode(reply interface{}) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
@@ -189,36 +1154,99 @@ func DecodeClientResponse(r io.Reader, reply interface{}) (err error) {
 		}
 	}()
 
-	var res rpcResponse
-	if err := gob.NewDecoder(r).Decode(&res); err != nil {
-		return err
-	}
-
 	if res.Error != nil {
 		return res.Error
 	}
+	if assignScalar(reply, res.Result) {
+		return nil
+	}
+	if !isNonNilPointer(reply) {
+		return NewError(fmt.Sprintf("invalid reply: must be a non-nil pointer, not %T", reply))
+	}
 
 	var (
 		va = reflect.ValueOf(reply).Elem()
 		vb = reflect.ValueOf(res.Result)
 	)
-	if !vb.Type().AssignableTo(va.Type()) {
-		return NewError(fmt.Sprintf("invalid return value: method returns %s, not %s", vb.Type().Name(), va.Type().Name()))
+	if !assign(va, vb) {
+		return NewError(fmt.Sprintf("invalid return value: method returns %s, not %s", vb.Type(), va.Type()))
 	}
-
-	va.Set(vb)
 	return nil
 }
 
+// isNonNilPointer reports whether v is a non-nil pointer.
+func isNonNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && !rv.IsNil()
+}
+
 func init() {
-	gob.Register(&rpcRequest{})
+	Register(&rpcRequest{})
+	Register(&Error{})
+	Register(Values{})
+	Register(&PanicError{})
+	Register(HealthStatus{})
+	Register(Pong{})
+	Register([]ServiceInfo{})
+
+	// Registered directly, so that it isn't listed by RegisteredTypes.
 	gob.Register(&errorString{})
+
+	// Build gob's type information for the messages up front, so that they
+	// are encoded the same way by every process. Gob names a type after
+	// how it is first encoded, and a batch's slice of pointers would
+	// otherwise leave them unnamed, and a little shorter, from then on.
+	gob.NewEncoder(io.Discard).Encode(&rpcRequest{})
+	gob.NewEncoder(io.Discard).Encode(&rpcResponse{})
+}
+
+// Register records a type so that values of it can be sent as params or
+// results. It forwards to gob.Register().
+func Register(value interface{}) {
+	gob.Register(value)
+	recordType(gobName(value))
+}
+
+// RegisterName is like Register but uses the provided name rather than the
+// type's default. It forwards to gob.RegisterName().
+func RegisterName(name string, value interface{}) {
+	gob.RegisterName(name, value)
+	recordType(name)
+}
+
+// RegisterError registers the concrete type of err, which is usually a
+// pointer to a struct, so that errors of that type can be returned from an
+// RPC method and reconstructed by the client with all of their exported
+// fields intact. Like Register, it must be called on both ends:
+//
+//	gob.RegisterError(&ValidationError{})
+//
+// An error of a type that isn't registered causes the call to fail with a
+// message naming the type and suggesting RegisterError.
+func RegisterError(err error) {
+	Register(err)
+}
+
+// RegisterTypes calls Register() on each of the given values.
+func RegisterTypes(values ...interface{}) {
+	for _, value := range values {
+		Register(value)
+	}
 }
 
 type rpcRequest struct {
 	Method string
 	Params interface{}
 	Id     uint64
+
+	// Stream reports whether the params follow the request as a stream
+	// of separately encoded values, instead of being held in Params.
+	Stream bool
+
+	// Schema is a hash of the structure of the client's type for Params,
+	// checked by a Codec with Strict set. It is zero if Params is nil or
+	// the client predates it.
+	Schema uint64
 }
 
 type rpcResponse struct {
@@ -227,6 +1255,41 @@ type rpcResponse struct {
 	Id     uint64
 }
 
+// Error is a gob-registered error carrying a machine-readable code along
+// with its message. Errors returned by NewError, NewErrorCode and WrapError
+// have this type, so clients can type-assert the error returned by
+// DecodeClientResponse to read the code.
+type Error struct {
+	Code    int
+	Message string
+
+	// Cause is the underlying error, if any. It is sent along with the
+	// error, so its concrete type must be gob-registered as well.
+	Cause error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the cause of the error, for use with errors.Is and
+// errors.As.
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether target is an *Error with the same code and message,
+// so that errors decoded from a response match the values they were
+// created from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Message == e.Message
+}
+
+// errorString is the error type that NewError returned before Error was
+// added. It is still registered so that errors sent by peers running an
+// older release can be decoded, but is never sent. It will be removed in
+// the next release.
 type errorString struct {
 	S string
 }
@@ -236,13 +1299,31 @@ func (e *errorString) Error() string {
 }
 
 // NewError returns a gob-registered error that formats as the given text.
+// It is shorthand for NewErrorCode(0, text).
 //
 // Unfortunately, errors created by the standard library's errors package
 // are not registered with encoding/gob, which is necessary in order to send
 // it over the wire via gob, and since the struct is private to the package,
-// there's no way for us to do it for them. As a result, returning an error
-// using errors.New(...) from an RPC method, when using this encoding, will
-// cause the client to receive an EOF error
+// there's no way for us to do it for them. An error returned by an RPC
+// method that can't be encoded, such as one created by errors.New(...), is
+// sent to the client as an *Error with the same message instead, so the
+// client can't recover its original type with errors.As.
+//
+// Custom error types may be used instead, as long as they are registered on
+// both ends with Register(). The client then receives a value of the same
+// concrete type, with all of its exported fields intact.
 func NewError(text string) error {
-	return &errorString{text}
+	return NewErrorCode(0, text)
+}
+
+// NewErrorCode returns a gob-registered error with the given code and message.
+func NewErrorCode(code int, message string) error {
+	return &Error{Code: code, Message: message}
+}
+
+// WrapError returns a gob-registered error that formats as the given text
+// and wraps cause. Since the cause is sent to the client along with the
+// error, it must also be gob-registered, such as one created by NewError.
+func WrapError(text string, cause error) error {
+	return &Error{Message: text, Cause: cause}
 }
@@ -0,0 +1,40 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrResponseHandled may be returned by a service method that has written
+// its own response, such as a file download or a redirect, to tell the
+// codec not to write one. The method gets hold of the http.ResponseWriter
+// with ResponseWriterFromRequest:
+//
+//	func (s *Service) Download(r *http.Request, name *string, _ *struct{}) error {
+//		w, ok := gob.ResponseWriterFromRequest(r)
+//		if !ok {
+//			return gob.NewError("downloads are not supported")
+//		}
+//		http.ServeFile(w, r, filepath.Join(s.dir, filepath.Base(*name)))
+//		return gob.ErrResponseHandled
+//	}
+var ErrResponseHandled = errors.New("gob: response handled by method")
+
+// ExposeResponseWriter returns a handler that makes the http.ResponseWriter
+// for each request available to service methods through
+// ResponseWriterFromRequest. It should wrap the Gorilla RPC server.
+func ExposeResponseWriter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), responseWriterKey, w)))
+	})
+}
+
+// ResponseWriterFromRequest returns the http.ResponseWriter for the request
+// being handled, for use by service methods that write their own response
+// and then return ErrResponseHandled. The boolean result reports whether
+// the request was served by a handler created by ExposeResponseWriter.
+func ResponseWriterFromRequest(r *http.Request) (http.ResponseWriter, bool) {
+	w, ok := r.Context().Value(responseWriterKey).(http.ResponseWriter)
+	return w, ok
+}
@@ -0,0 +1,49 @@
+package gob
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type RedirectService struct{}
+
+func (RedirectService) To(r *http.Request, url *string, _ *struct{}) error {
+	w, ok := ResponseWriterFromRequest(r)
+	if !ok {
+		return NewError("no response writer")
+	}
+	http.Redirect(w, r, *url, http.StatusSeeOther)
+	return ErrResponseHandled
+}
+
+func TestErrResponseHandled(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: RedirectService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(ExposeResponseWriter(s))
+	defer server.Close()
+
+	req, err := BuildRequest(server.URL, "RedirectService.To", "/elsewhere")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/elsewhere" {
+		t.Errorf("expected a redirect to /elsewhere, got %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// Without ExposeResponseWriter, the method has no writer to use.
+	err = NewTestClient(s).Call("RedirectService.To", "/elsewhere", nil)
+	if err == nil || err.Error() != "no response writer" {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package gob
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+// HealthStatus is the reply of the Health.Check method, and the JSON body
+// served by a HealthService over plain HTTP.
+type HealthStatus struct {
+	Status   string   `json:"status"`
+	Services []string `json:"services"`
+}
+
+// HealthService is a built-in service for liveness probes. It is also an
+// http.Handler that serves the same status as JSON, for load balancers
+// and other tools that don't speak gob, typically mounted at /healthz.
+type HealthService struct {
+	// Registry is the registry that the server's services were registered
+	// through. The names of the services it has recorded are reported,
+	// so that monitoring can verify the expected ones are present. If it
+	// is nil, no services are reported.
+	Registry *ServiceRegistry
+}
+
+// Pong is the reply of the Health.Ping method.
+type Pong struct {
+	// Nonce is the nonce sent with the ping, so that a client can tell
+	// that its args made it through the codec and back.
+	Nonce uint64
+
+	// Time is the time on the server when the ping was handled.
+	Time time.Time
+}
+
+// RegisterHealth registers a HealthService under the name "Health" with s,
+// making the "Health.Check" and "Health.Ping" methods available, and
+// returns it so that it can also be mounted as a plain HTTP handler. The
+// service reports the services recorded by registry, and is recorded there
+// itself. registry may be nil, in which case no services are reported.
+func RegisterHealth(s *rpc.Server, registry *ServiceRegistry) (*HealthService, error) {
+	h := &HealthService{Registry: registry}
+	if registry == nil {
+		if err := s.RegisterService(h, "Health"); err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+	if err := registry.Register(s, h, "Health"); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Check replies with the health of the server.
+func (h *HealthService) Check(r *http.Request, _ *struct{}, reply *HealthStatus) error {
+	*reply = h.status()
+	return nil
+}
+
+// Ping replies with the nonce it was sent, for clients checking that the
+// server can be reached. See Client.Ping.
+func (h *HealthService) Ping(r *http.Request, nonce *uint64, reply *Pong) error {
+	*reply = Pong{Nonce: *nonce, Time: time.Now()}
+	return nil
+}
+
+func (h *HealthService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.status())
+}
+
+func (h *HealthService) status() HealthStatus {
+	status := HealthStatus{Status: "ok"}
+	if h.Registry != nil {
+		for _, info := range h.Registry.Services() {
+			status.Services = append(status.Services, info.Name)
+		}
+	}
+	return status
+}
+
+// Ping checks that the server can be reached and speaks gob-RPC by calling
+// its Health.Ping method, which must have been registered with
+// RegisterHealth, and checking that the reply echoes what was sent. It
+// goes through the same codec and transport as any other call, but is
+// never retried. Any failure is reported as an error that wraps the
+// underlying *TransportError or *RPCError.
+func (c *Client) Ping(ctx context.Context) error {
+	nonce := newRequestID()
+	once := *c
+	once.RetryPolicy = nil
+
+	var pong Pong
+	if err := once.CallContext(ctx, "Health.Ping", nonce, &pong); err != nil {
+		return fmt.Errorf("ping failed: server unreachable or not serving gob-RPC: %w", err)
+	}
+	if pong.Nonce != nonce {
+		return NewError("ping failed: server replied to a different ping")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package gob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	var registry ServiceRegistry
+	s, err := registry.NewServer(ServiceReg{Service: &SomeService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	health, err := RegisterHealth(s, &registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/rpc", s)
+	mux.Handle("/healthz", health)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var status HealthStatus
+	if err := NewClient(server.URL+"/rpc", nil).Call("Health.Check", nil, &status); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Health", "SomeService"}; status.Status != "ok" || !reflect.DeepEqual(status.Services, want) {
+		t.Errorf("received unexpected status: %+v", status)
+	}
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var plain HealthStatus
+	if err := json.NewDecoder(resp.Body).Decode(&plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain.Status != "ok" || len(plain.Services) != 2 {
+		t.Errorf("received unexpected status from /healthz: %+v", plain)
+	}
+}
+
+func TestPing(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &SomeService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegisterHealth(s, nil); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	if err := NewClient(server.URL, nil).Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A server without a HealthService, or one that isn't a gob-RPC
+	// server at all, fails the ping.
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+	for _, url := range []string{ts.URL, other.URL} {
+		err := NewClient(url, nil).Ping(context.Background())
+		if err == nil || !strings.HasPrefix(err.Error(), "ping failed: ") {
+			t.Errorf("%s: received unexpected error: %v", url, err)
+		}
+	}
+
+	other.Close()
+	err = NewClient(other.URL, nil).Ping(context.Background())
+	var te *TransportError
+	if !errors.As(err, &te) {
+		t.Errorf("expected an unreachable server to fail with a *TransportError, got %v", err)
+	}
+}
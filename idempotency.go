@@ -0,0 +1,205 @@
+package gob
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the HTTP header that clients use to mark retries
+// of the same logical request, so that the server can avoid performing it
+// more than once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// CachedResponse is a complete HTTP response held by a ResponseCache.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ResponseCache stores responses by key for a limited time. Implementations
+// must be safe for concurrent use, and may be backed by an external store
+// such as Redis.
+type ResponseCache interface {
+	// Get returns the response stored under key, if it hasn't expired.
+	Get(key string) (*CachedResponse, bool)
+
+	// Set stores res under key for the duration of ttl.
+	Set(key string, res *CachedResponse, ttl time.Duration)
+}
+
+// MemoryCache is a ResponseCache that holds responses in memory. Expired
+// entries are removed in order of expiry as new ones are added, so adding
+// one doesn't need to look at the others.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	expiry  expiryHeap
+}
+
+type memoryCacheEntry struct {
+	res     *CachedResponse
+	expires time.Time
+}
+
+// NewMemoryCache returns a new, empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.res, true
+}
+
+func (c *MemoryCache) Set(key string, res *CachedResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for len(c.expiry) > 0 && now.After(c.expiry[0].expires) {
+		item := heap.Pop(&c.expiry).(expiryItem)
+		// The key may have been set again since, with a later expiry.
+		if entry, ok := c.entries[item.key]; ok && entry.expires.Equal(item.expires) {
+			delete(c.entries, item.key)
+		}
+	}
+	expires := now.Add(ttl)
+	c.entries[key] = memoryCacheEntry{res: res, expires: expires}
+	heap.Push(&c.expiry, expiryItem{key: key, expires: expires})
+}
+
+// expiryItem records when the entry set under key expires.
+type expiryItem struct {
+	key     string
+	expires time.Time
+}
+
+// expiryHeap is a container/heap of the entries of a MemoryCache, ordered
+// by when they expire.
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryItem)) }
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Deduplicate returns a handler that remembers the response h writes for
+// each request carrying an Idempotency-Key header, for the duration of ttl.
+// A later request with the same key and body gets the remembered response
+// replayed instead of being passed to h, so a retried call isn't performed
+// twice. A request that arrives while one with the same key and body is
+// still being handled waits for its response. It is shorthand for
+// DeduplicateWithScope(h, cache, ttl, nil).
+//
+// Since the body names the method and carries its params, a key that is
+// reused for a different call doesn't get the response to the first one,
+// but a retry must send the very same body, as a Client's retries do.
+// Requests without a key are passed through unchanged, and responses with
+// a 5xx status aren't remembered, so those requests may be retried.
+func Deduplicate(h http.Handler, cache ResponseCache, ttl time.Duration) http.Handler {
+	return DeduplicateWithScope(h, cache, ttl, nil)
+}
+
+// DeduplicateWithScope is like Deduplicate, but also keeps the responses
+// remembered for requests apart by the result of scope, such as the
+// authenticated user making them, so that a caller can't be sent the
+// response to another caller's request by reusing its key. A nil scope
+// puts every request in the same scope.
+func DeduplicateWithScope(h http.Handler, cache ResponseCache, ttl time.Duration, scope func(r *http.Request) string) http.Handler {
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]chan struct{})
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, NewError(err.Error()))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		key = deduplicationKey(r, key, body, scope)
+
+		for {
+			mu.Lock()
+			done, busy := inFlight[key]
+			if !busy {
+				inFlight[key] = make(chan struct{})
+			}
+			mu.Unlock()
+			if !busy {
+				break
+			}
+			select {
+			case <-done:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		defer func() {
+			mu.Lock()
+			close(inFlight[key])
+			delete(inFlight, key)
+			mu.Unlock()
+		}()
+
+		// The cache is only checked once no other request with the key
+		// is in flight, so that the response of one that has just
+		// finished is seen.
+		if res, ok := cache.Get(key); ok {
+			res.writeTo(w)
+			return
+		}
+		buf := newResponseBuffer()
+		h.ServeHTTP(buf, r)
+		res := &CachedResponse{StatusCode: buf.status, Header: buf.header, Body: buf.body.Bytes()}
+		if res.StatusCode < 500 {
+			cache.Set(key, res, ttl)
+		}
+		res.writeTo(w)
+	})
+}
+
+// deduplicationKey returns the key under which the response to r, which
+// has the given idempotency key and body, is remembered.
+func deduplicationKey(r *http.Request, key string, body []byte, scope func(r *http.Request) string) string {
+	var caller string
+	if scope != nil {
+		caller = scope(r)
+	}
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("gob-rpc idempotency:%q:%q:%s %s:%s", caller, key, r.Method, r.URL.Path, hex.EncodeToString(sum[:]))
+}
+
+// writeTo writes the cached response to w.
+func (res *CachedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	w.Write(res.Body)
+}
@@ -0,0 +1,166 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type CounterService struct {
+	n int64
+}
+
+func (s *CounterService) Increment(r *http.Request, _ *struct{}, reply *int64) error {
+	if _, ok := IdempotencyKeyFromRequest(r); !ok {
+		return NewError("missing idempotency key")
+	}
+	*reply = atomic.AddInt64(&s.n, 1)
+	return nil
+}
+
+// deduplicatedCall sends the given message to url with an idempotency key,
+// optionally for the given user, and returns the decoded result. It may
+// be called from other goroutines, so it reports errors with t.Error.
+func deduplicatedCall(t *testing.T, url string, message []byte, key, user string) int64 {
+	req, err := newRequest(context.Background(), url, message)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	req.Header.Set(IdempotencyKeyHeader, key)
+	req.Header.Set("X-User", user)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	defer resp.Body.Close()
+
+	var n int64
+	if err := DecodeResponse(resp, &n); err != nil {
+		t.Error(err)
+		return 0
+	}
+	return n
+}
+
+func TestDeduplicate(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &CounterService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(Deduplicate(s, NewMemoryCache(), time.Minute))
+	defer server.Close()
+
+	// A retry sends the same message again.
+	message, err := EncodeClientRequestWithID("CounterService.Increment", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := deduplicatedCall(t, server.URL, message, "a", ""); n != 1 {
+		t.Errorf("expected first call to return 1, got %d", n)
+	}
+	if n := deduplicatedCall(t, server.URL, message, "a", ""); n != 1 {
+		t.Errorf("expected a retry with the same key to be replayed, got %d", n)
+	}
+	if n := deduplicatedCall(t, server.URL, message, "b", ""); n != 2 {
+		t.Errorf("expected a call with a new key to run, got %d", n)
+	}
+
+	// A different call with a reused key isn't sent the first response.
+	other, err := EncodeClientRequestWithID("CounterService.Increment", nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := deduplicatedCall(t, server.URL, other, "a", ""); n != 3 {
+		t.Errorf("expected a different call with a reused key to run, got %d", n)
+	}
+}
+
+func TestDeduplicateWithScope(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &CounterService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(r *http.Request) string { return r.Header.Get("X-User") }
+	server := httptest.NewServer(DeduplicateWithScope(s, NewMemoryCache(), time.Minute, user))
+	defer server.Close()
+
+	message, err := EncodeClientRequestWithID("CounterService.Increment", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := deduplicatedCall(t, server.URL, message, "a", "alice"); n != 1 {
+		t.Errorf("expected first call to return 1, got %d", n)
+	}
+	if n := deduplicatedCall(t, server.URL, message, "a", "bob"); n != 2 {
+		t.Errorf("expected another user's call with the same key to run, got %d", n)
+	}
+	if n := deduplicatedCall(t, server.URL, message, "a", "alice"); n != 1 {
+		t.Errorf("expected a retry by the same user to be replayed, got %d", n)
+	}
+}
+
+func TestDeduplicateConcurrent(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &CounterService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(Deduplicate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		s.ServeHTTP(w, r)
+	}), NewMemoryCache(), time.Minute))
+	defer server.Close()
+
+	message, err := EncodeClientRequestWithID("CounterService.Increment", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan int64, 2)
+	go func() { results <- deduplicatedCall(t, server.URL, message, "a", "") }()
+	<-started
+	go func() { results <- deduplicatedCall(t, server.URL, message, "a", "") }()
+	// Give the duplicate time to arrive while the first is in flight.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if n := <-results; n != 1 {
+			t.Errorf("expected both calls to return 1, got %d", n)
+		}
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	c := NewMemoryCache()
+	c.Set("a", &CachedResponse{StatusCode: http.StatusOK}, -time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected an expired entry to be missing")
+	}
+	c.Set("b", &CachedResponse{StatusCode: http.StatusOK}, time.Minute)
+	if _, ok := c.Get("b"); !ok {
+		t.Error("expected an unexpired entry to be present")
+	}
+	if _, ok := c.entries["a"]; ok {
+		t.Error("expected the expired entry to be removed")
+	}
+
+	// An entry that is set again isn't removed when its first expiry
+	// passes.
+	c.Set("c", &CachedResponse{StatusCode: http.StatusOK}, 10*time.Millisecond)
+	c.Set("c", &CachedResponse{StatusCode: http.StatusOK}, time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	c.Set("d", &CachedResponse{StatusCode: http.StatusOK}, time.Minute)
+	if _, ok := c.Get("c"); !ok {
+		t.Error("expected an entry that was set again to be present")
+	}
+}
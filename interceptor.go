@@ -0,0 +1,46 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+)
+
+// Invoker makes a call of the named method, decoding its result into
+// reply, as Client.CallContext does. It takes a context even for the kinds
+// of call that don't, such as those made with Call, Go or Notify, which
+// are made with context.Background(), so that interceptors can pass values
+// such as headers on to the rest of the call in the same way for all.
+type Invoker func(ctx context.Context, method string, args, reply interface{}) error
+
+// Interceptor wraps an Invoker to add behavior around the calls made by a
+// Client, such as authentication, logging or metrics. It is the client
+// side counterpart to Middleware. An interceptor may change the context,
+// args or reply that are passed on to next, or not call next at all.
+type Interceptor func(next Invoker) Invoker
+
+// chainInterceptors returns invoke wrapped in each of the given
+// interceptors, with the first being the outermost, as with Chain.
+func chainInterceptors(invoke Invoker, interceptors []Interceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		invoke = interceptors[i](invoke)
+	}
+	return invoke
+}
+
+// WithHeaders returns a copy of ctx that causes the given headers to be set
+// on the requests of calls made with it, in the same way as
+// BuildRequestWithHeaders. It's how an Interceptor adds headers to a call,
+// such as an authorization token. Headers already added to ctx are kept,
+// unless they're given again in header.
+func WithHeaders(ctx context.Context, header http.Header) context.Context {
+	merged := make(http.Header)
+	if prev, ok := ctx.Value(headersKey).(http.Header); ok {
+		for key, values := range prev {
+			merged[key] = values
+		}
+	}
+	for key, values := range header {
+		merged[http.CanonicalHeaderKey(key)] = values
+	}
+	return context.WithValue(ctx, headersKey, merged)
+}
@@ -0,0 +1,98 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: HeaderService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTestClient(s)
+
+	var order []string
+	trace := func(name string) Interceptor {
+		return func(next Invoker) Invoker {
+			return func(ctx context.Context, method string, args, reply interface{}) error {
+				order = append(order, name+" "+method)
+				return next(ctx, method, args, reply)
+			}
+		}
+	}
+	auth := func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, reply interface{}) error {
+			return next(WithHeaders(ctx, http.Header{"Authorization": {"Bearer secret"}}), method, args, reply)
+		}
+	}
+	c.Interceptors = []Interceptor{trace("outer"), auth, trace("inner")}
+
+	var reply string
+	if err := c.Call("HeaderService.Get", "Authorization", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Bearer secret" {
+		t.Errorf("expected the Authorization header to arrive, got %q", reply)
+	}
+	if len(order) != 2 || order[0] != "outer HeaderService.Get" || order[1] != "inner HeaderService.Get" {
+		t.Errorf("expected the interceptors to run in order, got %q", order)
+	}
+
+	// Headers given to the call itself are kept alongside the
+	// interceptor's.
+	header := http.Header{"X-Tenant": {"acme"}}
+	if err := c.CallWithHeaders(context.Background(), "HeaderService.Get", "X-Tenant", &reply, header); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "acme" {
+		t.Errorf("expected the X-Tenant header to arrive, got %q", reply)
+	}
+
+	errDenied := errors.New("denied")
+	c.Interceptors = []Interceptor{func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, reply interface{}) error {
+			return errDenied
+		}
+	}}
+	if err := c.Call("HeaderService.Get", "X-Tenant", &reply); err != errDenied {
+		t.Errorf("expected the interceptor's error, got %v", err)
+	}
+}
+
+func TestInterceptorsOtherCalls(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &SomeService{}}, ServiceReg{Service: BlobService{}}, ServiceReg{Service: IngestService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	var methods []string
+	c.Interceptors = []Interceptor{func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, reply interface{}) error {
+			methods = append(methods, method)
+			return next(WithHeaders(ctx, http.Header{"Authorization": {"Bearer secret"}}), method, args, reply)
+		}
+	}}
+
+	if err := c.Notify("SomeService.Echo", "hello"); err != nil {
+		t.Errorf("Notify: %s", err)
+	}
+	if _, err := c.CallRaw(context.Background(), "BlobService.Render", "gopher"); err != nil {
+		t.Errorf("CallRaw: %s", err)
+	}
+	var sum int
+	if err := c.CallStream(context.Background(), "IngestService.Sum", sendInts(3), &sum); err != nil || sum != 6 {
+		t.Errorf("CallStream: expected 6, got %d, %v", sum, err)
+	}
+	if len(methods) != 3 {
+		t.Errorf("expected every call to be intercepted, got %q", methods)
+	}
+}
@@ -0,0 +1,195 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSONContentType is the Content-Type of requests sent by a Client with
+// JSON set, and the media type Gorilla's json codec is usually registered
+// under.
+const JSONContentType = "application/json"
+
+// jsonResponse is the JSON form of a response, sent by a Codec with
+// JSONResponses set. Its fields match the responses of Gorilla RPC's json
+// codec, so tools that read those can read these too.
+type jsonResponse struct {
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+	Id     uint64      `json:"id"`
+}
+
+// jsonRequest is the JSON form of a request, as read by Gorilla RPC's json
+// codec. Params holds the single argument, and a nil Id marks a
+// notification.
+type jsonRequest struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	Id     *uint64       `json:"id"`
+}
+
+// EncodeJSONRequest is like EncodeClientRequest, but encodes the request
+// for Gorilla RPC's json codec instead of this one, so that the same
+// method can be called on a server where gob isn't available. args and
+// the reply must then be types that encoding/json can handle.
+func EncodeJSONRequest(method string, args interface{}) ([]byte, error) {
+	return encodeJSONRequest(method, args, IDGenerator())
+}
+
+// encodeJSONRequest encodes a JSON request with the given id, or a
+// notification if id is zero.
+func encodeJSONRequest(method string, args interface{}, id uint64) ([]byte, error) {
+	req := &jsonRequest{Method: method, Params: []interface{}{args}}
+	if id != 0 {
+		req.Id = &id
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, NewError(fmt.Sprintf("unable to encode JSON request: %s", err))
+	}
+	return b, nil
+}
+
+// DecodeJSONResponse is like DecodeResponse, but decodes a response from
+// Gorilla RPC's json codec, or from a Codec with JSONResponses set, such as
+// to a request encoded with EncodeJSONRequest. As with DecodeResponse, a
+// response from a server wrapped with Keepalive() is read past its
+// keepalive padding first.
+func DecodeJSONResponse(resp *http.Response, reply interface{}) error {
+	if err := readKeepalive(resp); err != nil {
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+	return decodeJSONResponse(resp, reply, 0)
+}
+
+// decodeJSONResponse is like DecodeJSONResponse, but fails without decoding
+// the body if it is larger than limit bytes, unless limit is zero.
+func decodeJSONResponse(resp *http.Response, reply interface{}, limit int64) error {
+	body, err := responseBody(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+	if limit > 0 {
+		body = http.MaxBytesReader(nil, ioutil.NopCloser(body), limit)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = NewError(fmt.Sprintf("response too large: limit is %d bytes", tooLarge.Limit))
+		}
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+
+	var res struct {
+		Result json.RawMessage `json:"result"`
+		Error  interface{}     `json:"error"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		switch {
+		case len(b) == 0:
+			err = NewError("empty JSON-RPC response body")
+		case resp.StatusCode >= 300 && isText(b):
+			err = NewError(strings.TrimSpace(string(b)))
+		default:
+			err = NewError(fmt.Sprintf("not a JSON-RPC response: %d bytes of %s", len(b), describeContentType(resp.Header.Get("Content-Type"))))
+		}
+		return &TransportError{StatusCode: resp.StatusCode, Err: err}
+	}
+	if res.Error != nil {
+		return &RPCError{Err: jsonError(res.Error)}
+	}
+	if reply == nil || len(res.Result) == 0 || string(res.Result) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(res.Result, reply); err != nil {
+		return NewError(fmt.Sprintf("invalid return value: %s", err))
+	}
+	return nil
+}
+
+// jsonError converts the error member of a JSON response to an error. The
+// json codec and JSONResponses send a string, but other servers may send
+// an object, which is kept in its JSON form.
+func jsonError(v interface{}) error {
+	if s, ok := v.(string); ok {
+		return NewError(s)
+	}
+	b, _ := json.Marshal(v)
+	return NewError(string(b))
+}
+
+// writeJSONResponse writes res to w as JSON, for requests that asked for it.
+func (c *CodecRequest) writeJSONResponse(w http.ResponseWriter, status int, res *rpcResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	out := &jsonResponse{Result: res.Result, Id: res.Id}
+	if res.Error != nil {
+		out.Error = res.Error.Error()
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		if c.codec.OnEncodeError != nil {
+			c.codec.OnEncodeError(err)
+		}
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(&jsonResponse{Error: err.Error(), Id: res.Id})
+	}
+	writeBuffered(w, status, bytes.NewBuffer(b))
+}
+
+// prefersJSON reports whether an Accept header asks for JSON in preference
+// to gob. Ties go to gob.
+func prefersJSON(accept string) bool {
+	if accept == "" {
+		return false
+	}
+	return acceptQuality(accept, "application/json") > acceptQuality(accept, "application/gob")
+}
+
+// acceptQuality returns the quality given to mediaType by an Accept
+// header, taking the most specific matching range, or zero if there is
+// none.
+func acceptQuality(accept, mediaType string) float64 {
+	var (
+		q           float64
+		specificity = -1
+	)
+	major := strings.SplitN(mediaType, "/", 2)[0]
+	for _, field := range strings.Split(accept, ",") {
+		parts := strings.Split(field, ";")
+		r := strings.ToLower(strings.TrimSpace(parts[0]))
+
+		var s int
+		switch r {
+		case mediaType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+	}
+	return q
+}
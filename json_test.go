@@ -0,0 +1,164 @@
+package gob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/rpc/v2"
+	rpcjson "github.com/gorilla/rpc/v2/json"
+)
+
+func TestPrefersJSON(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", true},
+		{"application/json, application/gob", false},
+		{"application/gob;q=0.5, application/json", true},
+		{"application/*", false},
+		{"*/*", false},
+		{"application/json;q=0.5, */*", false},
+		{"application/json;q=0", false},
+		{"text/html, application/json;q=0.9", true},
+	} {
+		if got := prefersJSON(test.accept); got != test.want {
+			t.Errorf("prefersJSON(%q) = %t, want %t", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestJSONResponses(t *testing.T) {
+	codec := NewCodec()
+	codec.JSONResponses = true
+	s := rpc.NewServer()
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterService(&SomeService{}, "")
+
+	for _, test := range []struct {
+		method string
+		args   interface{}
+		status int
+		want   jsonResponse
+	}{
+		{"SomeService.Echo", "hello", http.StatusOK, jsonResponse{Result: "hello", Id: 7}},
+		{"SomeService.Error", nil, http.StatusInternalServerError, jsonResponse{Error: "uh-oh", Id: 7}},
+	} {
+		message, err := EncodeClientRequestWithID(test.method, test.args, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(message))
+		req.Header.Set("Content-Type", DefaultContentType)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.method, test.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s: unexpected Content-Type %q", test.method, ct)
+		}
+		var got jsonResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %s", test.method, err)
+		}
+		if got != test.want {
+			t.Errorf("%s: expected %+v, got %+v", test.method, test.want, got)
+		}
+	}
+
+	// Gob clients are unaffected.
+	server := httptest.NewServer(s)
+	defer server.Close()
+	var reply string
+	if err := NewClient(server.URL, nil).Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// jsonCodecServer returns a server with Gorilla's json codec registered,
+// as a client with JSON set expects to find.
+func jsonCodecServer() *httptest.Server {
+	s := rpc.NewServer()
+	s.RegisterCodec(rpcjson.NewCodec(), JSONContentType)
+	s.RegisterService(&SomeService{}, "")
+	return httptest.NewServer(s)
+}
+
+func TestClientJSON(t *testing.T) {
+	server := jsonCodecServer()
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+	c.JSON = true
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+
+	err := c.Call("SomeService.Missing", "hello", &reply)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || err.Error() != `rpc: can't find method "SomeService.Missing"` {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+
+	if err := c.Notify("SomeService.Echo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CallRaw(context.Background(), "SomeService.Echo", "hello"); err == nil {
+		t.Error("expected CallRaw to fail for a JSON client")
+	}
+}
+
+func TestClientJSONResponses(t *testing.T) {
+	// A Codec with JSONResponses set answers JSON clients in kind, given a
+	// json codec to read their requests.
+	s := rpc.NewServer()
+	codec := NewCodec()
+	codec.JSONResponses = true
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterService(&SomeService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	message, err := EncodeClientRequestWithID("SomeService.Error", nil, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", server.URL, bytes.NewReader(message))
+	req.Header.Set("Content-Type", DefaultContentType)
+	req.Header.Set("Accept", JSONContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := DecodeJSONResponse(resp, nil); err == nil || err.Error() != "uh-oh" {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+}
+
+func TestDecodeJSONResponseNonJSON(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("upstream connect error")),
+	}
+	err := DecodeJSONResponse(resp, new(string))
+	if err == nil || err.Error() != "transport error (HTTP 502): upstream connect error" {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+}
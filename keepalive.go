@@ -0,0 +1,207 @@
+package gob
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeepaliveHeader is the HTTP header with which a client asks a server
+// wrapped with Keepalive() to keep the connection busy during long calls,
+// and with which the server marks a response that it has done so for.
+const KeepaliveHeader = "X-Gob-RPC-Keepalive"
+
+// Keepalive wraps a handler, usually a Gorilla RPC server, so that calls
+// that take longer than interval to respond don't leave the connection
+// idle for long enough to be dropped by a proxy or load balancer with an
+// idle timeout. It only does so for requests from clients that ask for it,
+// such as a Client with Keepalive set, since others wouldn't understand
+// the response; other requests are passed on to h untouched.
+//
+// If h hasn't started its response within interval, a 200 OK response is
+// started with KeepaliveHeader set, and a single space is then written
+// and flushed every interval until h responds. The status and headers
+// that h responds with follow as a newline and a block of MIME headers,
+// with the status given by a "Status" header, and then the body:
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/octet-stream
+//	X-Gob-RPC-Keepalive: 1
+//
+//	<spaces>\n
+//	Status: 500
+//	Content-Type: application/gob; charset=binary
+//
+//	<gob-encoded response>
+//
+// Responses that h starts within interval are sent as usual. Since the
+// real status follows the padding, intermediaries see every call that was
+// kept alive as having succeeded. The http.Server's WriteTimeout, if any,
+// still applies to the whole response.
+func Keepalive(h http.Handler, interval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(KeepaliveHeader) == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// The padding may be sent before h has read the request body,
+		// which the HTTP/1 server otherwise doesn't allow. Writers that
+		// don't support this, such as those of HTTP/2, don't need to.
+		http.NewResponseController(w).EnableFullDuplex()
+
+		kw := &keepaliveWriter{w: w, header: make(http.Header)}
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kw.run(interval, done)
+		}()
+
+		h.ServeHTTP(kw, r)
+		close(done)
+		wg.Wait()
+		if !kw.started {
+			kw.WriteHeader(http.StatusOK)
+		}
+	})
+}
+
+// keepaliveWriter is the http.ResponseWriter for a request being handled by
+// Keepalive(). Until the handler starts its response, its headers are kept
+// apart from those of the underlying writer, which may already have been
+// sent by the time they're complete.
+type keepaliveWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	// mu guards writes to w, and started and padded. Both are only set
+	// with mu held, but since only the handler sets started, it's free
+	// to read it without.
+	mu      sync.Mutex
+	started bool // the handler has started its response
+	padded  bool // the keepalive response has been started
+}
+
+// run writes keepalive padding every interval until the handler starts its
+// response or done is closed.
+func (kw *keepaliveWriter) run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		kw.mu.Lock()
+		if kw.started {
+			kw.mu.Unlock()
+			return
+		}
+		if !kw.padded {
+			kw.padded = true
+			kw.w.Header().Set(KeepaliveHeader, "1")
+			kw.w.Header().Set("Content-Type", "application/octet-stream")
+			kw.w.WriteHeader(http.StatusOK)
+		}
+		io.WriteString(kw.w, " ")
+		flush(kw.w)
+		kw.mu.Unlock()
+	}
+}
+
+func (kw *keepaliveWriter) Header() http.Header {
+	return kw.header
+}
+
+func (kw *keepaliveWriter) WriteHeader(code int) {
+	kw.mu.Lock()
+	defer kw.mu.Unlock()
+	if kw.started {
+		return
+	}
+	kw.started = true
+
+	if !kw.padded {
+		for k, v := range kw.header {
+			kw.w.Header()[k] = v
+		}
+		kw.w.WriteHeader(code)
+		return
+	}
+	fmt.Fprintf(kw.w, "\nStatus: %d\r\n", code)
+	kw.header.Write(kw.w)
+	io.WriteString(kw.w, "\r\n")
+}
+
+func (kw *keepaliveWriter) Write(p []byte) (int, error) {
+	if !kw.started {
+		kw.WriteHeader(http.StatusOK)
+	}
+	return kw.w.Write(p)
+}
+
+func (kw *keepaliveWriter) Flush() {
+	if !kw.started {
+		kw.WriteHeader(http.StatusOK)
+	}
+	flush(kw.w)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (kw *keepaliveWriter) Unwrap() http.ResponseWriter {
+	return kw.w
+}
+
+// readKeepalive reads past the keepalive padding at the start of resp, a
+// response from a server wrapped with Keepalive(), and replaces its status
+// and headers with those sent after it. Other responses are left as they
+// are.
+func readKeepalive(resp *http.Response) error {
+	if resp.Header.Get(KeepaliveHeader) == "" {
+		return nil
+	}
+
+	br := bufio.NewReader(resp.Body)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			break
+		}
+		if b != ' ' {
+			return NewError(fmt.Sprintf("malformed keepalive response: unexpected byte %#x in padding", b))
+		}
+	}
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	code, err := strconv.Atoi(header.Get("Status"))
+	if err != nil || code < 100 || code > 999 {
+		return NewError(fmt.Sprintf("malformed keepalive response: invalid status %q", header.Get("Status")))
+	}
+	header.Del("Status")
+
+	resp.StatusCode = code
+	resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+	resp.Header = http.Header(header)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, resp.Body}
+	return nil
+}
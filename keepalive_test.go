@@ -0,0 +1,128 @@
+package gob
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/rpc/v2"
+	rpcjson "github.com/gorilla/rpc/v2/json"
+)
+
+func TestKeepalive(t *testing.T) {
+	server := httptest.NewServer(Keepalive(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		rs.ServeHTTP(w, r)
+	}), 5*time.Millisecond))
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+	c.Keepalive = true
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	c.Compressor = Gzip
+	var rpcErr *RPCError
+	if err := c.Call("SomeService.Error", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Error() != "uh-oh" {
+		t.Errorf("expected the method's error, got %v", err)
+	}
+
+	for _, keepalive := range []bool{true, false} {
+		req, err := BuildRequest(server.URL, "SomeService.Echo", "hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keepalive {
+			req.Header.Set(KeepaliveHeader, "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get(KeepaliveHeader) != ""; got != keepalive {
+			t.Errorf("expected keepalive to be %t, got %t", keepalive, got)
+		}
+		reply = ""
+		if err := DecodeResponse(resp, &reply); err != nil || reply != "hello" {
+			t.Errorf("expected reply %q, got %q, %v", "hello", reply, err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestKeepaliveQuickResponse(t *testing.T) {
+	server := httptest.NewServer(Keepalive(rs, time.Hour))
+	defer server.Close()
+
+	req, err := BuildRequest(server.URL, "SomeService.Error", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(KeepaliveHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get(KeepaliveHeader) != "" {
+		t.Errorf("expected a plain 500 response, got %d with headers %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestKeepaliveJSON(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterCodec(rpcjson.NewCodec(), JSONContentType)
+	s.RegisterService(&SomeService{}, "")
+	server := httptest.NewServer(Keepalive(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		s.ServeHTTP(w, r)
+	}), 5*time.Millisecond))
+	defer server.Close()
+
+	message, err := EncodeJSONRequest("SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", server.URL, bytes.NewReader(message))
+	req.Header.Set("Content-Type", JSONContentType)
+	req.Header.Set(KeepaliveHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get(KeepaliveHeader) == "" {
+		t.Fatal("expected the response to be kept alive")
+	}
+	var reply string
+	if err := DecodeJSONResponse(resp, &reply); err != nil || reply != "hello" {
+		t.Errorf("expected reply %q, got %q, %v", "hello", reply, err)
+	}
+}
+
+func TestKeepaliveUnwrap(t *testing.T) {
+	var deadlineErr error
+	server := httptest.NewServer(Keepalive(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadlineErr = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	}), time.Hour))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	req.Header.Set(KeepaliveHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	waitForHandlers(server)
+	if deadlineErr != nil {
+		t.Errorf("expected the write deadline to reach the connection, got %v", deadlineErr)
+	}
+}
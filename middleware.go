@@ -0,0 +1,216 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware wraps an http.Handler to add behavior around it, such as
+// authentication or logging. Middleware applied around a Gorilla RPC server
+// sees every request before the codec does, and can wrap the
+// http.ResponseWriter to see the response it writes.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain returns h wrapped in each of the given middleware, with the first
+// being the outermost, so that it's the first to see each request. The
+// handlers in this package that take another handler can be chained by
+// wrapping them in a closure:
+//
+//	h := gob.Chain(s,
+//		logRequests,
+//		func(h http.Handler) http.Handler { return gob.LimitConcurrency(h, 100) },
+//		codec.Recover,
+//	)
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// ErrServerBusy is sent to clients when a handler created by
+// LimitConcurrency is already serving as many requests as it allows. Its
+// code is 503, matching the HTTP status of the response, and the request
+// may be retried later.
+var ErrServerBusy = NewErrorCode(http.StatusServiceUnavailable, "server busy")
+
+// LimitConcurrency returns a handler that allows at most max requests to be
+// served by h at the same time. Requests beyond that are rejected
+// immediately with a 503 status and ErrServerBusy, rather than being
+// queued. A max of zero or less means no limit, and returns h unchanged.
+func LimitConcurrency(h http.Handler, max int) http.Handler {
+	if max <= 0 {
+		return h
+	}
+	sem := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			h.ServeHTTP(w, r)
+		default:
+			r.Body.Close()
+			writeErrorResponse(w, http.StatusServiceUnavailable, ErrServerBusy)
+		}
+	})
+}
+
+// RequireContentType returns a handler that only passes requests on to h
+// if their Content-Type has one of the given media types, ignoring any
+// parameters such as charset. Other requests, including those without a
+// Content-Type, are rejected with a 415 Unsupported Media Type status and
+// a plain text message listing the accepted types. If no types are given,
+// only "application/gob" is accepted.
+func RequireContentType(h http.Handler, types ...string) http.Handler {
+	if len(types) == 0 {
+		types = []string{"application/gob"}
+	}
+	accepted := make(map[string]bool, len(types))
+	for _, t := range types {
+		accepted[mediaType(t)] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Header.Get("Content-Type")
+		if !accepted[mediaType(ct)] {
+			r.Body.Close()
+			msg := fmt.Sprintf("unsupported Content-Type %q: expected %s", ct, strings.Join(types, " or "))
+			http.Error(w, msg, http.StatusUnsupportedMediaType)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// LogRequests returns a Middleware that logs one line to logger for every
+// request, once it has been handled, giving the method called, the id of
+// the request, the HTTP status of the response and how long the request
+// took:
+//
+//	"SomeService.Echo" id=8412086523108838583 status=200 duration=1.2ms
+//
+// The method is quoted, since it comes from the client and could otherwise
+// be used to forge log lines. Requests whose method can't be read, such as
+// those that aren't gob-RPC requests at all, are logged with an unquoted
+// method of -. If logger is nil, log.Default() is used.
+//
+// The method and id are read from the start of the request body, which is
+// then restored for the next handler. Doing so buffers the first gob
+// message of the body, which for requests other than streams is all of
+// it, so a size limit should be applied by an earlier handler if one is
+// needed.
+func LogRequests(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			method, id, err := peekRequest(r)
+			name := strconv.Quote(method)
+			if err != nil {
+				name = "-"
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			logger.Printf("%s id=%d status=%d duration=%s", name, id, sw.status(), time.Since(start))
+		})
+	}
+}
+
+// peekRequest reads the method and id of the gob-RPC request in the body of
+// r, leaving the body as it was for the handlers that follow. Params aren't
+// decoded, so their types don't need to be registered.
+func peekRequest(r *http.Request) (method string, id uint64, err error) {
+	var buf bytes.Buffer
+	defer func(body io.ReadCloser) {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&buf, body), body}
+	}(r.Body)
+
+	return decodeHead(r.Header.Get("Content-Encoding"), io.TeeReader(r.Body, &buf))
+}
+
+// PeekMethod returns the method named by the gob-RPC request in the body of
+// r, for middleware that needs it before the codec runs, such as for
+// routing or authorization:
+//
+//	method, err := gob.PeekMethod(r)
+//	if err != nil || !allowed(r, method) {
+//		http.Error(w, "forbidden", http.StatusForbidden)
+//		return
+//	}
+//	next.ServeHTTP(w, r)
+//
+// Only as much of the body as it takes to decode the first gob message is
+// read, and r.Body is replaced with a reader that returns it again before
+// the rest, so that the codec can still decode the request. This keeps
+// large uploads out of memory and works for requests to streaming methods
+// too. Params aren't decoded, so their types don't need to be registered.
+func PeekMethod(r *http.Request) (string, error) {
+	method, _, err := peekRequest(r)
+	return method, err
+}
+
+// decodeHead decodes the method and id at the start of a gob-RPC request
+// body sent with the given Content-Encoding.
+func decodeHead(encoding string, r io.Reader) (method string, id uint64, err error) {
+	body, err := responseBody(encoding, r)
+	if err != nil {
+		return "", 0, err
+	}
+	var head struct {
+		Method string
+		Id     uint64
+	}
+	if err := gob.NewDecoder(body).Decode(&head); err != nil {
+		return "", 0, err
+	}
+	return head.Method, head.Id, nil
+}
+
+// statusWriter records the status of the response written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// status returns the status of the response, which is 200 if the handler
+// wrote nothing at all.
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
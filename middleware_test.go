@@ -0,0 +1,185 @@
+package gob
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(LimitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		rs.ServeHTTP(w, r)
+	}), 1))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	var first string
+	done := c.Go("SomeService.Echo", "first", &first)
+	<-entered
+
+	err := c.Call("SomeService.Echo", "second", new(string))
+	if !errors.Is(err, ErrServerBusy) {
+		t.Fatalf("expected ErrServerBusy, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if first != "first" {
+		t.Errorf("received unexpected response: %s", first)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	server := httptest.NewServer(Chain(rs, mark("first"), mark("second"), NewCodec().Recover))
+	defer server.Close()
+
+	var reply string
+	if err := NewClient(server.URL, nil).Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("middleware ran in the wrong order: %v", order)
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	server := httptest.NewServer(RequireContentType(rs))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d, got %d", http.StatusUnsupportedMediaType, resp.StatusCode)
+	}
+	if want := `unsupported Content-Type "text/plain": expected application/gob`; strings.TrimSpace(string(body)) != want {
+		t.Errorf("received unexpected message: %s", body)
+	}
+
+	var reply string
+	if err := NewClient(server.URL, nil).Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	defer func(g func() uint64) { IDGenerator = g }(IDGenerator)
+	IDGenerator = func() uint64 { return 1234 }
+
+	var out bytes.Buffer
+	server := httptest.NewServer(Chain(rs, LogRequests(log.New(&out, "", 0))))
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+	c.Compressor = Gzip
+	if err := c.Call("SomeService.Error", nil, nil); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if err := c.Call("SomeService.Echo\nforged line", "x", &reply); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	resp, err := http.Post(server.URL, DefaultContentType, strings.NewReader("not gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	waitForHandlers(server)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`"SomeService.Echo" id=1234 status=200 duration=`,
+		`"SomeService.Error" id=1234 status=500 duration=`,
+		`"SomeService.Echo\nforged line" id=1234 status=`,
+		"- id=0 status=400 duration=",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines to be logged, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("expected a line starting with %q, got %q", want[i], line)
+		}
+	}
+}
+
+func TestPeekMethod(t *testing.T) {
+	var peeked string
+	c := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, err := PeekMethod(r)
+		if err != nil {
+			t.Errorf("failed to peek method: %s", err)
+		}
+		peeked = method
+		rs.ServeHTTP(w, r)
+	}))
+
+	for _, compressor := range []Compressor{nil, Gzip} {
+		c.Compressor = compressor
+		var reply string
+		if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != "hello" {
+			t.Errorf("expected reply %q, got %q", "hello", reply)
+		}
+		if peeked != "SomeService.Echo" {
+			t.Errorf("expected to peek method SomeService.Echo, got %q", peeked)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("not gob"))
+	if _, err := PeekMethod(r); err == nil {
+		t.Error("expected an error for a body that isn't gob-RPC")
+	}
+	if b, _ := ioutil.ReadAll(r.Body); string(b) != "not gob" {
+		t.Errorf("expected the body to be restored, got %q", b)
+	}
+
+	// Only the first message is read, so the rest of a streamed body
+	// doesn't have to have arrived.
+	message, err := EncodeClientRequest("SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write(message)
+	r = httptest.NewRequest("POST", "/", pr)
+	if method, err := PeekMethod(r); err != nil || method != "SomeService.Echo" {
+		t.Errorf("expected to peek method SomeService.Echo, got %q (%v)", method, err)
+	}
+}
@@ -0,0 +1,129 @@
+package gob
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	netrpc "net/rpc"
+)
+
+// NewClientCodec returns a net/rpc client codec that speaks over conn using
+// the same request and response framing as this package's HTTP codec, for
+// use with net/rpc's NewClientWithCodec().
+//
+// Since net/rpc sequence numbers start at zero, but an id of zero denotes a
+// notification here, each request is sent with an id of its sequence
+// number plus one.
+func NewClientCodec(conn io.ReadWriteCloser) netrpc.ClientCodec {
+	buf := bufio.NewWriter(conn)
+	return &clientCodec{
+		conn: conn,
+		dec:  gob.NewDecoder(conn),
+		enc:  gob.NewEncoder(buf),
+		buf:  buf,
+	}
+}
+
+type clientCodec struct {
+	conn io.ReadWriteCloser
+	dec  *gob.Decoder
+	enc  *gob.Encoder
+	buf  *bufio.Writer
+	res  rpcResponse
+}
+
+func (c *clientCodec) WriteRequest(r *netrpc.Request, body interface{}) error {
+	if err := c.enc.Encode(&rpcRequest{Method: r.ServiceMethod, Params: body, Id: r.Seq + 1}); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c *clientCodec) ReadResponseHeader(r *netrpc.Response) error {
+	c.res = rpcResponse{}
+	if err := c.dec.Decode(&c.res); err != nil {
+		return err
+	}
+	r.Seq = c.res.Id - 1
+	if c.res.Error != nil {
+		r.Error = c.res.Error.Error()
+	}
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	if body == nil || c.res.Result == nil {
+		return nil
+	}
+	return (&rpcResponse{Result: c.res.Result}).decode(body)
+}
+
+func (c *clientCodec) Close() error {
+	return c.conn.Close()
+}
+
+// NewServerCodec returns a net/rpc server codec that speaks over conn using
+// the same request and response framing as this package's HTTP codec, for
+// use with net/rpc's ServeCodec(). Requests with an id of zero are treated
+// as notifications, and no response is written for them.
+//
+// Note that net/rpc service methods have the signature
+//
+//	func (t *T) MethodName(args T1, reply *T2) error
+//
+// without the leading *http.Request parameter that Gorilla RPC adds, so the
+// same service type can't be registered with both. Sharing an
+// implementation means writing one of them as a thin wrapper around the
+// other.
+func NewServerCodec(conn io.ReadWriteCloser) netrpc.ServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &serverCodec{
+		conn: conn,
+		dec:  gob.NewDecoder(conn),
+		enc:  gob.NewEncoder(buf),
+		buf:  buf,
+	}
+}
+
+type serverCodec struct {
+	conn io.ReadWriteCloser
+	dec  *gob.Decoder
+	enc  *gob.Encoder
+	buf  *bufio.Writer
+	req  rpcRequest
+}
+
+func (c *serverCodec) ReadRequestHeader(r *netrpc.Request) error {
+	c.req = rpcRequest{}
+	if err := c.dec.Decode(&c.req); err != nil {
+		return err
+	}
+	r.ServiceMethod = c.req.Method
+	r.Seq = c.req.Id
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	if body == nil {
+		return nil
+	}
+	return (&CodecRequest{codec: &Codec{}, request: &c.req}).ReadRequest(body)
+}
+
+func (c *serverCodec) WriteResponse(r *netrpc.Response, body interface{}) error {
+	if r.Seq == 0 {
+		return nil
+	}
+	res := &rpcResponse{Result: body, Id: r.Seq}
+	if r.Error != "" {
+		res.Result, res.Error = nil, NewError(r.Error)
+	}
+	if err := c.enc.Encode(res); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c *serverCodec) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,48 @@
+package gob
+
+import (
+	"net"
+	netrpc "net/rpc"
+	"testing"
+)
+
+type NetService struct{}
+
+func (s *NetService) Echo(args string, reply *string) error {
+	*reply = args
+	return nil
+}
+
+func (s *NetService) Error(args string, reply *string) error {
+	return NewError("uh-oh")
+}
+
+func TestNetRPCCodecs(t *testing.T) {
+	server := netrpc.NewServer()
+	if err := server.Register(&NetService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeCodec(NewServerCodec(serverConn))
+	client := netrpc.NewClientWithCodec(NewClientCodec(clientConn))
+	defer client.Close()
+
+	for _, s := range []string{"hello", "world"} {
+		var reply string
+		if err := client.Call("NetService.Echo", s, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != s {
+			t.Errorf("received unexpected response: %s", reply)
+		}
+	}
+
+	err := client.Call("NetService.Error", "hello", new(string))
+	if err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if err.Error() != "uh-oh" {
+		t.Fatalf("received unexpected error: %s", err)
+	}
+}
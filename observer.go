@@ -0,0 +1,63 @@
+package gob
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Observer receives notifications about the requests handled by a Codec,
+// for recording metrics such as call counts, latencies and error rates.
+//
+// Its methods may be called concurrently from multiple goroutines.
+type Observer interface {
+	// RequestDecoded is called once a request for method has been
+	// successfully decoded.
+	RequestDecoded(method string)
+
+	// ResponseWritten is called after the response to a request has been
+	// written. The err argument is the error sent to the client, if any,
+	// bytes is the size of the response body and elapsed is the time since
+	// the codec began decoding the request.
+	ResponseWritten(method string, err error, bytes int, elapsed time.Duration)
+}
+
+// countingWriter is an http.ResponseWriter that counts the bytes written
+// to the response body.
+type countingWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += n
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// countingReader is an io.ReadCloser that counts the bytes read from a
+// request body.
+type countingReader struct {
+	io.ReadCloser
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += n
+	return n, err
+}
+
+// flush flushes w if it supports flushing, so that a response written to it
+// is sent straight away instead of waiting in a buffer. The ResponseWriter
+// wrappers in this package flush with it, so that their Flush methods pass
+// on flushes to the writers they wrap.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
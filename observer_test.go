@@ -0,0 +1,133 @@
+package gob
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+type recordingObserver struct {
+	mu      sync.Mutex
+	decoded []string
+	written []observedResponse
+}
+
+type observedResponse struct {
+	method string
+	err    error
+	bytes  int
+}
+
+func (o *recordingObserver) RequestDecoded(method string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.decoded = append(o.decoded, method)
+}
+
+func (o *recordingObserver) ResponseWritten(method string, err error, bytes int, elapsed time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.written = append(o.written, observedResponse{method, err, bytes})
+}
+
+func TestObserver(t *testing.T) {
+	observer := new(recordingObserver)
+	codec := NewCodec()
+	codec.Observer = observer
+
+	s := rpc.NewServer()
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterService(&SomeService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call("SomeService.Error", nil, nil); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+
+	waitForHandlers(server)
+
+	if len(observer.decoded) != 2 || observer.decoded[0] != "SomeService.Echo" || observer.decoded[1] != "SomeService.Error" {
+		t.Errorf("unexpected decoded methods: %v", observer.decoded)
+	}
+	if len(observer.written) != 2 {
+		t.Fatalf("expected 2 written responses, got %d", len(observer.written))
+	}
+	if w := observer.written[0]; w.method != "SomeService.Echo" || w.err != nil || w.bytes == 0 {
+		t.Errorf("unexpected observation for Echo: %+v", w)
+	}
+	if w := observer.written[1]; w.method != "SomeService.Error" || w.err == nil || w.bytes == 0 {
+		t.Errorf("unexpected observation for Error: %+v", w)
+	}
+}
+
+func TestOnBytes(t *testing.T) {
+	defer func(g func() uint64) { IDGenerator = g }(IDGenerator)
+	IDGenerator = func() uint64 { return 1234 }
+	message := strings.Repeat("hello", 100)
+
+	type counts struct {
+		method  string
+		in, out int
+	}
+	for _, test := range []struct {
+		name string
+		call func(t *testing.T, c *Client)
+		want counts
+	}{
+		{"plain", func(t *testing.T, c *Client) {
+			var reply string
+			if err := c.Call("SomeService.Echo", message, &reply); err != nil {
+				t.Fatal(err)
+			}
+		}, counts{"SomeService.Echo", 629, 580}},
+		{"gzip", func(t *testing.T, c *Client) {
+			c.Compressor = Gzip
+			var reply string
+			if err := c.Call("SomeService.Echo", message, &reply); err != nil {
+				t.Fatal(err)
+			}
+		}, counts{"SomeService.Echo", 158, 109}},
+		{"error", func(t *testing.T, c *Client) {
+			if err := c.Call("SomeService.Error", nil, nil); err == nil {
+				t.Fatal("expected an error, but none was returned")
+			}
+		}, counts{"SomeService.Error", 102, 136}},
+		{"get", func(t *testing.T, c *Client) {
+			req, err := BuildGetRequest("http://gob-rpc.test/", "SomeService.Echo", "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.httpClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}, counts{"SomeService.Echo", 168, 77}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var reported []counts
+			codec := NewCodec()
+			codec.OnBytes = func(method string, in, out int) {
+				reported = append(reported, counts{method, in, out})
+			}
+			s := rpc.NewServer()
+			s.RegisterCodec(codec, "application/gob")
+			s.RegisterService(&SomeService{}, "")
+
+			test.call(t, NewTestClient(AllowGET(s, 0, "SomeService.Echo")))
+			if len(reported) != 1 || reported[0] != test.want {
+				t.Errorf("expected the call to be reported as %+v, got %+v", test.want, reported)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package gob
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// PanicError is the error sent to the client when a panic is recovered
+// while handling its request.
+//
+// If the codec's IncludePanicStack option is set, the stack trace of the
+// panic is captured as well. It is meant for logging on the server, via the
+// codec's OnPanic hook, and is never sent to the client.
+type PanicError struct {
+	Message string
+
+	stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return "panic: " + e.Message
+}
+
+// Stack returns the stack trace captured when the panic was recovered, or
+// nil if it wasn't captured.
+func (e *PanicError) Stack() []byte {
+	return e.stack
+}
+
+// newPanicError returns a *PanicError for the recovered value r, capturing
+// the current stack if includeStack is true.
+func newPanicError(r interface{}, includeStack bool) *PanicError {
+	e := &PanicError{Message: fmt.Sprint(r)}
+	if includeStack {
+		buf := make([]byte, 64<<10)
+		e.stack = buf[:runtime.Stack(buf, false)]
+	}
+	return e
+}
+
+// Recover returns a handler that recovers panics in h, such as those raised
+// by service methods, and sends the client a *PanicError with a 500 status
+// instead of dropping the connection. The panic is reported to the codec's
+// OnPanic hook, if set, along with its stack trace if IncludePanicStack is
+// set.
+//
+// If h has already started writing its response when it panics, the rest
+// of the response can't be replaced, so the client is likely to receive a
+// truncated response.
+func (c *Codec) Recover(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				err := newPanicError(v, c.IncludePanicStack)
+				if c.OnPanic != nil {
+					c.OnPanic(err)
+				}
+				writeErrorResponse(w, http.StatusInternalServerError, err)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
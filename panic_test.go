@@ -0,0 +1,46 @@
+package gob
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func (s *SomeService) Panic(*http.Request, *struct{}, *struct{}) error {
+	panic("boom")
+}
+
+func TestRecoverPanic(t *testing.T) {
+	for _, includeStack := range []bool{false, true} {
+		var reported *PanicError
+		codec := NewCodec()
+		codec.IncludePanicStack = includeStack
+		codec.OnPanic = func(err *PanicError) { reported = err }
+
+		s, err := NewServer(ServiceReg{Service: &SomeService{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(codec.Recover(s))
+
+		err = NewClient(server.URL, nil).Call("SomeService.Panic", nil, nil)
+		server.Close()
+
+		var pe *PanicError
+		if !errors.As(err, &pe) || pe.Message != "boom" {
+			t.Fatalf("expected a *PanicError for %q, got %v", "boom", err)
+		}
+		if pe.Stack() != nil {
+			t.Error("expected the stack not to be sent to the client")
+		}
+
+		if reported == nil {
+			t.Fatal("expected the panic to be reported")
+		}
+		if hasStack := bytes.Contains(reported.Stack(), []byte("SomeService).Panic")); hasStack != includeStack {
+			t.Errorf("with IncludePanicStack %t, captured stack = %q", includeStack, reported.Stack())
+		}
+	}
+}
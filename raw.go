@@ -0,0 +1,108 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// RawResult is the reply type of a method whose result is already
+// serialized, such as a pre-rendered document. Its Data is written to the
+// response body as is, without being gob-encoded in a response envelope,
+// so it must be read with Client.CallRaw rather than Client.Call:
+//
+//	func (s *Service) Report(r *http.Request, args *Args, reply *gob.RawResult) error {
+//		reply.ContentType = "application/pdf"
+//		reply.Data = s.render(args)
+//		return nil
+//	}
+//
+// Without the envelope, the response doesn't carry the request id, and it
+// isn't compressed. Errors returned by the method are still sent as usual.
+type RawResult struct {
+	// ContentType is the Content-Type of the response. If empty,
+	// "application/octet-stream" is used.
+	ContentType string
+
+	Data []byte
+}
+
+// writeTo writes the raw result to w as a 200 OK response.
+func (raw *RawResult) writeTo(w http.ResponseWriter) {
+	ct := raw.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw.Data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(raw.Data)
+	flush(w)
+}
+
+// CallRaw invokes the named method, whose reply type must be RawResult,
+// and returns the result as it was written by the method. An error is
+// returned in the same way as by Call.
+func (c *Client) CallRaw(ctx context.Context, method string, args interface{}) (*RawResult, error) {
+	raw := new(RawResult)
+	if err := c.intercept(ctx, method, args, raw, c.invokeRaw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// invokeRaw makes a call for CallRaw, once any interceptors have been
+// applied, storing the result in reply, which must be a *RawResult.
+func (c *Client) invokeRaw(ctx context.Context, method string, args, reply interface{}) (err error) {
+	raw, ok := reply.(*RawResult)
+	if !ok {
+		return NewError(fmt.Sprintf("invalid reply: must be a *RawResult, not %T", reply))
+	}
+	if c.JSON {
+		return NewError("raw results can't be received by a JSON client")
+	}
+	message, err := EncodeClientRequest(method, args)
+	if err != nil {
+		return err
+	}
+
+	if c.CircuitBreaker != nil {
+		if !c.CircuitBreaker.allow() {
+			return ErrCircuitOpen
+		}
+		defer func() { c.CircuitBreaker.record(ctx, err) }()
+	}
+
+	resp, err := c.send(ctx, message)
+	if err != nil {
+		err = &TransportError{Err: err}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = decodeResponse(resp, nil, c.MaxResponseBytes)
+		return err
+	}
+
+	body, err := responseBody(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err == nil && c.MaxResponseBytes > 0 {
+		body = http.MaxBytesReader(nil, ioutil.NopCloser(body), c.MaxResponseBytes)
+	}
+	var data []byte
+	if err == nil {
+		data, err = ioutil.ReadAll(body)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = NewError(fmt.Sprintf("response too large: limit is %d bytes", tooLarge.Limit))
+		}
+		err = &TransportError{StatusCode: resp.StatusCode, Err: err}
+		return err
+	}
+	*raw = RawResult{ContentType: resp.Header.Get("Content-Type"), Data: data}
+	return nil
+}
@@ -0,0 +1,45 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type BlobService struct{}
+
+func (BlobService) Render(_ *http.Request, args *string, reply *RawResult) error {
+	if *args == "" {
+		return NewError("nothing to render")
+	}
+	reply.ContentType = "text/csv"
+	reply.Data = []byte("name\n" + *args + "\n")
+	return nil
+}
+
+func TestCallRaw(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: BlobService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTestClient(s)
+
+	raw, err := c.CallRaw(context.Background(), "BlobService.Render", "gopher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.ContentType != "text/csv" || string(raw.Data) != "name\ngopher\n" {
+		t.Errorf("received unexpected result: %q %q", raw.ContentType, raw.Data)
+	}
+
+	if _, err := c.CallRaw(context.Background(), "BlobService.Render", ""); err == nil || err.Error() != "nothing to render" {
+		t.Errorf("received unexpected error: %v", err)
+	}
+
+	c.MaxResponseBytes = 4
+	_, err = c.CallRaw(context.Background(), "BlobService.Render", "gopher")
+	if err == nil || !strings.Contains(err.Error(), "response too large") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package gob
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ReadTimeout wraps a handler, usually a Gorilla RPC server, so that
+// clients have at most timeout to send the body of a request, which stops
+// slow clients from tying up the server by sending it a little at a time.
+// Unlike Codec.ReadTimeout, it sets a deadline on the connection itself,
+// so a read that is waiting for the client fails once the time is up, and
+// the request is rejected with an error. The deadline is lifted once the
+// body has been read in full, and once h returns, so it doesn't limit how
+// long h may take to respond, or how long the connection may then wait
+// for the next request.
+//
+// The ResponseWriter must support SetReadDeadline, as those of net/http's
+// servers do; otherwise, requests are passed on to h without a deadline.
+func ReadTimeout(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		defer rc.SetReadDeadline(time.Time{})
+		r.Body = &deadlineBody{ReadCloser: r.Body, rc: rc}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// deadlineBody is the body of a request with a read deadline set by
+// ReadTimeout(), which it lifts once the body has been read in full.
+type deadlineBody struct {
+	io.ReadCloser
+	rc *http.ResponseController
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.rc.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
+
+// readTimeoutError replaces an error from reading a request body past the
+// deadline set by ReadTimeout() with one that can be sent back to the
+// client.
+func readTimeoutError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return NewError("request body not received in time")
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package gob
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+type SleepService struct{}
+
+// Sleep waits for the given number of milliseconds.
+func (SleepService) Sleep(r *http.Request, ms *int, reply *int) error {
+	select {
+	case <-time.After(time.Duration(*ms) * time.Millisecond):
+		*reply = *ms
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+func TestReadTimeoutHandler(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	s.RegisterService(SleepService{}, "")
+	server := httptest.NewServer(ReadTimeout(s, 50*time.Millisecond))
+	defer server.Close()
+
+	message, err := EncodeClientRequest("SleepService.Sleep", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client sends the start of the request and then stalls, which
+	// the codec's own ReadTimeout wouldn't notice.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write(message[:len(message)/2])
+	req, err := http.NewRequest("POST", server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", DefaultContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	err = DecodeClientResponse(resp.Body, new(int))
+	if err == nil || !strings.Contains(err.Error(), "request body not received in time") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+
+	// A deadline doesn't limit how long the method may take once the
+	// body has been read.
+	c := NewClient(server.URL, nil)
+	if err := c.Call("SleepService.Sleep", 100, new(int)); err != nil {
+		t.Fatalf("received unexpected error for a slow method: %s", err)
+	}
+}
+
+func TestReadTimeoutIdleConnection(t *testing.T) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	s.RegisterService(SleepService{}, "")
+	var conns int32
+	server := httptest.NewUnstartedServer(ReadTimeout(s, 50*time.Millisecond))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// The deadline is lifted after each call, so the connection can stay
+	// idle for longer than the timeout and be used again.
+	c := NewClient(server.URL, server.Client())
+	for i := 0; i < 2; i++ {
+		if err := c.Call("SleepService.Sleep", 0, new(int)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("expected both calls to use one connection, got %d", n)
+	}
+}
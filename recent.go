@@ -0,0 +1,162 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RecentRequest describes a request recorded by a RecentLog.
+type RecentRequest struct {
+	// Time is when the request arrived.
+	Time time.Time `json:"time"`
+
+	// Method and Id are those of the request, or "-" and zero if it
+	// couldn't be read.
+	Method string `json:"method"`
+	Id     uint64 `json:"id"`
+
+	// Status is the HTTP status of the response.
+	Status int `json:"status"`
+
+	// Duration is how long the request took to handle, in nanoseconds
+	// when encoded as JSON.
+	Duration time.Duration `json:"duration"`
+
+	// Error is the message of the error sent in the response, if any.
+	Error string `json:"error,omitempty"`
+
+	// Bytes is the size of the response body as it was sent.
+	Bytes int `json:"bytes"`
+}
+
+// RecentLog keeps the last few requests passed through its Middleware, for
+// a debugging dashboard or for inspecting a production server without
+// tracing infrastructure. It is also an http.Handler that serves the
+// recorded requests as a JSON array, most recent first. It is safe for
+// concurrent use, and holds at most the number of requests it was created
+// with.
+//
+//	recent := gob.RecentRequests(100)
+//	mux.Handle("/rpc", gob.Chain(s, recent.Middleware))
+//	mux.Handle("/debug/rpc", recent)
+//
+// Like LogRequests, the middleware reads the method and id from the start
+// of the request body, so a size limit should be applied by an earlier
+// handler if one is needed.
+type RecentLog struct {
+	mu       sync.Mutex
+	requests []RecentRequest
+	next     int  // index in requests at which to record the next request
+	full     bool // whether requests has wrapped around
+}
+
+// RecentRequests returns a RecentLog that keeps the last n requests. An n
+// of less than one is treated as one.
+func RecentRequests(n int) *RecentLog {
+	if n < 1 {
+		n = 1
+	}
+	return &RecentLog{requests: make([]RecentRequest, n)}
+}
+
+// Middleware records each request handled by next in the log. It is a
+// Middleware, for use with Chain.
+func (l *RecentLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := RecentRequest{Time: time.Now()}
+		var err error
+		req.Method, req.Id, err = peekRequest(r)
+		if err != nil {
+			req.Method = "-"
+		}
+		rw := &recentWriter{statusWriter: statusWriter{ResponseWriter: w}}
+		next.ServeHTTP(rw, r)
+
+		req.Duration = time.Since(req.Time)
+		req.Status, req.Bytes = rw.status(), rw.n
+		if req.Status >= 300 {
+			req.Error = responseError(rw.Header().Get("Content-Encoding"), rw.body.Bytes())
+		}
+		l.record(req)
+	})
+}
+
+func (l *RecentLog) record(req RecentRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests[l.next] = req
+	l.next++
+	if l.next == len(l.requests) {
+		l.next, l.full = 0, true
+	}
+}
+
+// Requests returns the recorded requests, most recent first.
+func (l *RecentLog) Requests() []RecentRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.requests)
+	}
+	requests := make([]RecentRequest, 0, n)
+	for i := 1; i <= n; i++ {
+		requests = append(requests, l.requests[(l.next-i+len(l.requests))%len(l.requests)])
+	}
+	return requests
+}
+
+// ServeHTTP serves the result of Requests() as JSON.
+func (l *RecentLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Requests())
+}
+
+// maxRecentBody is the most of an error response body that a RecentLog
+// keeps for reading the error from. Error responses are much smaller than
+// this unless they aren't gob-RPC responses at all.
+const maxRecentBody = 64 << 10
+
+// recentWriter is a statusWriter that also counts the bytes of the response
+// and keeps the start of an error response's body.
+type recentWriter struct {
+	statusWriter
+	n    int
+	body bytes.Buffer
+}
+
+func (w *recentWriter) Write(p []byte) (int, error) {
+	n, err := w.statusWriter.Write(p)
+	w.n += n
+	if w.status() >= 300 && w.body.Len() < maxRecentBody {
+		w.body.Write(p[:n])
+	}
+	return n, err
+}
+
+// responseError returns the message of the error in a gob-RPC error
+// response body sent with the given Content-Encoding, or a description of
+// the body if it doesn't hold one.
+func responseError(encoding string, b []byte) string {
+	if len(b) >= maxRecentBody {
+		return "error response too large to record"
+	}
+	body, err := responseBody(encoding, bytes.NewReader(b))
+	var res rpcResponse
+	if err == nil {
+		err = gob.NewDecoder(body).Decode(&res)
+	}
+	switch {
+	case err != nil && isText(b):
+		return string(bytes.TrimSpace(b))
+	case err != nil:
+		return "undecodable error response: " + err.Error()
+	case res.Error == nil:
+		return ""
+	}
+	return res.Error.Error()
+}
@@ -0,0 +1,74 @@
+package gob
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecentRequests(t *testing.T) {
+	recent := RecentRequests(2)
+	server := httptest.NewServer(Chain(rs, recent.Middleware))
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	c.Compressor = Gzip
+	if err := c.Call("SomeService.Error", nil, nil); err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	resp, err := http.Post(server.URL, DefaultContentType, strings.NewReader("not gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	waitForHandlers(server)
+
+	requests := recent.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected the 2 most recent requests, got %+v", requests)
+	}
+	if r := requests[0]; r.Method != "-" || r.Status != http.StatusBadRequest || r.Error == "" {
+		t.Errorf("received unexpected request: %+v", r)
+	}
+	if r := requests[1]; r.Method != "SomeService.Error" || r.Id == 0 || r.Status != http.StatusInternalServerError || r.Error != "uh-oh" || r.Bytes == 0 {
+		t.Errorf("received unexpected request: %+v", r)
+	}
+
+	w := httptest.NewRecorder()
+	recent.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	var served []RecentRequest
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 2 || served[1].Method != "SomeService.Error" {
+		t.Errorf("received unexpected requests: %+v", served)
+	}
+}
+
+func TestRecentRequestsConcurrent(t *testing.T) {
+	recent := RecentRequests(5)
+	c := NewTestClient(Chain(rs, recent.Middleware))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply string
+			c.Call("SomeService.Echo", "hello", &reply)
+			recent.Requests()
+		}()
+	}
+	wg.Wait()
+	if n := len(recent.Requests()); n != 5 {
+		t.Errorf("expected 5 requests to be kept, got %d", n)
+	}
+}
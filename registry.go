@@ -0,0 +1,136 @@
+package gob
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+// ServiceInfo describes a service recorded by a ServiceRegistry.
+type ServiceInfo struct {
+	Name    string
+	Methods []MethodInfo
+}
+
+// MethodInfo describes a method of a service, naming the types it takes as
+// args and reply.
+type MethodInfo struct {
+	Name  string
+	Args  string
+	Reply string
+}
+
+// ServiceRegistry records the services registered with a Gorilla RPC
+// server through it, so that they can be listed for tooling and
+// documentation. The zero value is ready to use. Services registered by
+// other means, such as by the package's NewServer and RegisterVersioned
+// functions, aren't recorded; the registry has methods of the same names
+// that record them.
+//
+// A registry can itself be registered with the server to let clients list
+// its services with the "ServiceRegistry.List" method:
+//
+//	var registry gob.ServiceRegistry
+//	registry.Register(s, &Service{}, "")
+//	registry.Register(s, &registry, "")
+type ServiceRegistry struct {
+	mu       sync.Mutex
+	services map[string]ServiceInfo
+}
+
+// Register registers svc with s under name, as s.RegisterService does, and
+// records it in the registry. If name is empty, the name of the receiver's
+// type is used.
+func (sr *ServiceRegistry) Register(s *rpc.Server, svc interface{}, name string) error {
+	if err := s.RegisterService(svc, name); err != nil {
+		return fmt.Errorf("registering service %T: %w", svc, err)
+	}
+	if name == "" {
+		name = reflect.Indirect(reflect.ValueOf(svc)).Type().Name()
+	}
+	sr.record(name, svc)
+	return nil
+}
+
+// NewServer returns a new server, as the package's NewServer does, with
+// each of the given services registered with it through the registry.
+func (sr *ServiceRegistry) NewServer(services ...ServiceReg) (*rpc.Server, error) {
+	s, err := NewServer()
+	if err != nil {
+		return nil, err
+	}
+	for _, reg := range services {
+		if err := sr.Register(s, reg.Service, reg.Name); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// RegisterVersioned registers svc with s under a versioned name, as the
+// package's RegisterVersioned does, and records it in the registry under
+// that name.
+func (sr *ServiceRegistry) RegisterVersioned(s *rpc.Server, svc interface{}, version string) (string, error) {
+	name, err := RegisterVersioned(s, svc, version)
+	if err != nil {
+		return "", err
+	}
+	sr.record(name, svc)
+	return name, nil
+}
+
+func (sr *ServiceRegistry) record(name string, svc interface{}) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.services == nil {
+		sr.services = make(map[string]ServiceInfo)
+	}
+	sr.services[name] = ServiceInfo{Name: name, Methods: methodsOf(svc)}
+}
+
+// Services returns the recorded services, sorted by name.
+func (sr *ServiceRegistry) Services() []ServiceInfo {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	services := make([]ServiceInfo, 0, len(sr.services))
+	for _, info := range sr.services {
+		services = append(services, info)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+// List replies with the result of Services().
+func (sr *ServiceRegistry) List(r *http.Request, _ *struct{}, reply *[]ServiceInfo) error {
+	*reply = sr.Services()
+	return nil
+}
+
+var (
+	typeOfRequest = reflect.TypeOf((*http.Request)(nil))
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// methodsOf returns the methods of svc that Gorilla RPC exposes, using the
+// same rules as it does, sorted by name.
+func methodsOf(svc interface{}) []MethodInfo {
+	var methods []MethodInfo
+	t := reflect.TypeOf(svc)
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		mt := m.Type
+		if m.PkgPath != "" || mt.NumIn() != 4 || mt.NumOut() != 1 {
+			continue
+		}
+		args, reply := mt.In(2), mt.In(3)
+		if mt.In(1) != typeOfRequest || args.Kind() != reflect.Ptr || reply.Kind() != reflect.Ptr || mt.Out(0) != typeOfError {
+			continue
+		}
+		methods = append(methods, MethodInfo{Name: m.Name, Args: args.Elem().String(), Reply: reply.Elem().String()})
+	}
+	return methods
+}
@@ -0,0 +1,42 @@
+package gob
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServiceRegistry(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registry ServiceRegistry
+	if err := registry.Register(s, &HealthService{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(s, &registry, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(s, &HealthService{}, ""); err == nil {
+		t.Error("expected an error registering a service twice")
+	}
+	if _, err := registry.RegisterVersioned(s, &GreetService{}, "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var services []ServiceInfo
+	if err := NewTestClient(s).Call("ServiceRegistry.List", nil, &services); err != nil {
+		t.Fatal(err)
+	}
+	want := []ServiceInfo{
+		{Name: "HealthService", Methods: []MethodInfo{
+			{Name: "Check", Args: "struct {}", Reply: "gob.HealthStatus"},
+			{Name: "Ping", Args: "uint64", Reply: "gob.Pong"},
+		}},
+		{Name: "ServiceRegistry", Methods: []MethodInfo{{Name: "List", Args: "struct {}", Reply: "[]gob.ServiceInfo"}}},
+		{Name: "v2_GreetService", Methods: []MethodInfo{{Name: "Greet", Args: "string", Reply: "string"}}},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("expected %+v, got %+v", want, services)
+	}
+}
@@ -0,0 +1,132 @@
+package gob
+
+import (
+	"encoding"
+	"encoding/gob"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// schemas caches the schema hash of each params type, since working it out
+// takes a walk over the type.
+var schemas sync.Map // map[reflect.Type]uint64
+
+// schemaOf returns a hash of the structure of the type of v, as gob sees
+// it, or zero if v is nil. It is sent along with a request's params so
+// that a Codec with Strict set can tell whether the client's type matches
+// its own.
+func schemaOf(v interface{}) uint64 {
+	if v == nil {
+		return 0
+	}
+	rt := reflect.TypeOf(v)
+	if h, ok := schemas.Load(rt); ok {
+		return h.(uint64)
+	}
+	var b strings.Builder
+	describeSchema(&b, rt, make(map[reflect.Type]bool))
+	h := fnv.New64a()
+	h.Write([]byte(b.String()))
+	sum := h.Sum64()
+	if sum == 0 {
+		// Zero means that no schema was sent.
+		sum = 1
+	}
+	schemas.Store(rt, sum)
+	return sum
+}
+
+var (
+	gobEncoderType    = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	binaryMarshalType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	textMarshalType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// describeSchema writes a description of rt to b that two types have in
+// common exactly when gob would decode one into the other without losing
+// or leaving out any fields. Names of types and the sizes of numbers
+// don't matter to gob, so they're left out, as are pointers, and struct
+// fields are listed by name in sorted order since gob matches them by
+// name. Types that encode themselves are opaque.
+func describeSchema(b *strings.Builder, rt reflect.Type, seen map[reflect.Type]bool) {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	for _, t := range []reflect.Type{gobEncoderType, binaryMarshalType, textMarshalType} {
+		if rt.Implements(t) || reflect.PtrTo(rt).Implements(t) {
+			b.WriteString("opaque")
+			return
+		}
+	}
+
+	switch rt.Kind() {
+	case reflect.Bool:
+		b.WriteString("bool")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString("int")
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString("uint")
+	case reflect.Float32, reflect.Float64:
+		b.WriteString("float")
+	case reflect.Complex64, reflect.Complex128:
+		b.WriteString("complex")
+	case reflect.String:
+		b.WriteString("string")
+	case reflect.Interface:
+		b.WriteString("interface")
+	case reflect.Slice, reflect.Array:
+		b.WriteString("[]")
+		describeSchema(b, rt.Elem(), seen)
+	case reflect.Map:
+		b.WriteString("map[")
+		describeSchema(b, rt.Key(), seen)
+		b.WriteString("]")
+		describeSchema(b, rt.Elem(), seen)
+	case reflect.Struct:
+		if seen[rt] {
+			// A recursive type is described where it first appears.
+			b.WriteString("recursive")
+			return
+		}
+		seen[rt] = true
+		defer delete(seen, rt)
+
+		var fields []reflect.StructField
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			if f.PkgPath != "" || isUnencodable(f.Type) {
+				continue
+			}
+			fields = append(fields, f)
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+		b.WriteString("{")
+		for i, f := range fields {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(f.Name)
+			b.WriteString(":")
+			describeSchema(b, f.Type, seen)
+		}
+		b.WriteString("}")
+	default:
+		b.WriteString(rt.Kind().String())
+	}
+}
+
+// isUnencodable reports whether gob silently skips struct fields of type
+// rt.
+func isUnencodable(rt reflect.Type) bool {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch rt.Kind() {
+	case reflect.Chan, reflect.Func:
+		return true
+	}
+	return false
+}
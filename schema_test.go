@@ -0,0 +1,88 @@
+package gob
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaV1 struct {
+	Name  string
+	Count int
+}
+
+type schemaV2 struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestSchemaOf(t *testing.T) {
+	type reordered struct {
+		Count int64
+		Name  string
+		note  string
+	}
+	type nested struct {
+		Items []schemaV1
+		When  time.Time
+	}
+	type nestedV2 struct {
+		Items []*schemaV2
+		When  time.Time
+	}
+	type list struct {
+		Value int
+		Next  *list
+	}
+
+	for _, test := range []struct {
+		a, b interface{}
+		same bool
+	}{
+		{schemaV1{}, &schemaV1{}, true},
+		{schemaV1{}, reordered{}, true},
+		{schemaV1{}, schemaV2{}, false},
+		{nested{}, nestedV2{}, false},
+		{list{}, list{Next: &list{}}, true},
+		{"hello", 3, false},
+	} {
+		if same := schemaOf(test.a) == schemaOf(test.b); same != test.same {
+			t.Errorf("%T and %T: expected same schema to be %t", test.a, test.b, test.same)
+		}
+	}
+	if schemaOf(nil) != 0 {
+		t.Error("expected nil params to have no schema")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		codec := NewCodec()
+		codec.Strict = strict
+
+		// The client's type had an extra field that the server's doesn't.
+		c := &CodecRequest{codec: codec, request: &rpcRequest{
+			Method: "SomeService.Echo",
+			Params: schemaV1{Name: "a"},
+			Id:     1,
+			Schema: schemaOf(schemaV2{}),
+		}}
+		var args schemaV1
+		err := c.ReadRequest(&args)
+		if !strict && err != nil {
+			t.Errorf("expected the mismatch to be ignored, got %v", err)
+		}
+		if strict && (err == nil || !strings.HasPrefix(err.Error(), "schema mismatch:")) {
+			t.Errorf("expected a schema mismatch, got %v", err)
+		}
+
+		// Requests with matching or missing schemas are let through.
+		for _, schema := range []uint64{schemaOf(schemaV1{}), 0} {
+			c := &CodecRequest{codec: codec, request: &rpcRequest{Method: "SomeService.Echo", Params: schemaV1{Name: "a"}, Id: 1, Schema: schema}}
+			if err := c.ReadRequest(&args); err != nil {
+				t.Errorf("received unexpected error: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package gob
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+// ServiceReg describes a service to be registered by NewServer.
+type ServiceReg struct {
+	// Service is the receiver whose methods are exposed.
+	Service interface{}
+
+	// Name is the name to register the service under. If empty, the name
+	// of the receiver's type is used.
+	Name string
+}
+
+// NewServer returns a new Gorilla RPC server with a gob codec registered
+// under the "application/gob" content type and each of the given services
+// registered with it.
+func NewServer(services ...ServiceReg) (*rpc.Server, error) {
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodec(), "application/gob")
+	for _, reg := range services {
+		if err := s.RegisterService(reg.Service, reg.Name); err != nil {
+			return nil, fmt.Errorf("registering service %T: %w", reg.Service, err)
+		}
+	}
+	return s, nil
+}
+
+// RegisterVersioned registers svc with s under a name that combines version
+// with the name of the receiver's type, so that several versions of the
+// same service can be served side by side. It returns the resulting service
+// name, which prefixes the method names that clients call. For example,
+// registering a *Service with version "v2" makes its methods available as
+// "v2_Service.Method".
+func RegisterVersioned(s *rpc.Server, svc interface{}, version string) (string, error) {
+	if version == "" || strings.Contains(version, ".") {
+		return "", fmt.Errorf("invalid service version %q", version)
+	}
+	t := reflect.TypeOf(svc)
+	if t == nil {
+		return "", fmt.Errorf("registering service %T: nil receiver", svc)
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := version + "_" + t.Name()
+	if err := s.RegisterService(svc, name); err != nil {
+		return "", fmt.Errorf("registering service %T: %w", svc, err)
+	}
+	return name, nil
+}
+
+// RegisterTypedService registers svc with s under the name of its type, as
+// s.RegisterService does, but first checks the signature of every method
+// that looks like it is meant to be called over RPC, meaning that it takes
+// an *http.Request as its first param. Gorilla RPC silently skips methods
+// whose signature is slightly off, so that a mistake only shows up as a
+// "method not found" error when the method is called. Instead, the
+// returned error names each offending method and what is wrong with it.
+// Other methods, such as a Close method, are skipped, as Gorilla RPC skips
+// them.
+func RegisterTypedService[S any](s *rpc.Server, svc S) error {
+	t := reflect.TypeOf(svc)
+	if t == nil {
+		return fmt.Errorf("registering service %T: nil receiver", svc)
+	}
+
+	var problems []string
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		if problem := checkSignature(m.Type); problem != "" {
+			problems = append(problems, m.Name+" "+problem)
+		}
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).NumMethod() > t.NumMethod() {
+		problems = append(problems, fmt.Sprintf("methods with pointer receivers aren't available on a %s value; register a *%s instead", t, t))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("registering service %T: %s", svc, strings.Join(problems, "; "))
+	}
+
+	if err := s.RegisterService(svc, ""); err != nil {
+		return fmt.Errorf("registering service %T: %w", svc, err)
+	}
+	return nil
+}
+
+// checkSignature returns what is wrong with mt, the type of a method
+// including its receiver, as a method that Gorilla RPC can call, or an
+// empty string if nothing is wrong or it isn't meant to be such a method.
+func checkSignature(mt reflect.Type) string {
+	if mt.NumIn() < 2 || mt.In(1) != typeOfRequest {
+		return ""
+	}
+
+	if mt.NumIn() != 4 {
+		return fmt.Sprintf("must take (*http.Request, *Args, *Reply), but takes %d params", mt.NumIn()-1)
+	}
+	for i, param := range []string{"args", "reply"} {
+		pt := mt.In(2 + i)
+		if pt.Kind() != reflect.Ptr {
+			return fmt.Sprintf("must take its %s as a pointer, not %s", param, pt)
+		}
+		if !isExportedOrBuiltin(pt.Elem()) {
+			return fmt.Sprintf("must take its %s as an exported type, not %s", param, pt.Elem())
+		}
+	}
+	if mt.NumOut() != 1 || mt.Out(0) != typeOfError {
+		return "must return only an error"
+	}
+	return ""
+}
+
+// isExportedOrBuiltin reports whether t can be used for args or a reply,
+// which Gorilla RPC requires to be exported or unnamed, as net/rpc does.
+func isExportedOrBuiltin(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath() == "" || token.IsExported(t.Name())
+}
@@ -0,0 +1,176 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+func TestNewServer(t *testing.T) {
+	s, err := NewServer(ServiceReg{Service: &SomeService{}}, ServiceReg{Service: &SomeService{}, Name: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	for _, method := range []string{"SomeService.Echo", "Other.Echo"} {
+		var reply string
+		if err := c.Call(method, "hello", &reply); err != nil {
+			t.Fatalf("%s: %s", method, err)
+		}
+		if reply != "hello" {
+			t.Errorf("%s: received unexpected response: %s", method, reply)
+		}
+	}
+}
+
+func TestNewServerError(t *testing.T) {
+	_, err := NewServer(ServiceReg{Service: &SomeService{}}, ServiceReg{Service: &SomeService{}})
+	if err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if !strings.Contains(err.Error(), "registering service *gob.SomeService") {
+		t.Fatalf("received unexpected error: %s", err)
+	}
+}
+
+func TestRegisterVersioned(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v1", "v2"} {
+		name, err := RegisterVersioned(s, &SomeService{}, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := version + "_SomeService"; name != want {
+			t.Errorf("expected service name %q, got %q", want, name)
+		}
+	}
+
+	c := NewTestClient(s)
+	for _, method := range []string{"v1_SomeService.Echo", "v2_SomeService.Echo"} {
+		var reply string
+		if err := c.Call(method, "hello", &reply); err != nil {
+			t.Fatalf("%s: %s", method, err)
+		}
+	}
+
+	if _, err := RegisterVersioned(s, &SomeService{}, "v2.1"); err == nil {
+		t.Error("expected an error for a version containing a dot")
+	}
+}
+
+func TestCustomContentType(t *testing.T) {
+	const contentType = "application/vnd.example.gob.v2"
+
+	s := rpc.NewServer()
+	s.RegisterCodec(NewCodecWithContentType(contentType), contentType)
+	s.RegisterService(&SomeService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	c.ContentType = contentType
+
+	message, err := EncodeClientRequest("SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.send(context.Background(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != contentType {
+		t.Errorf("unexpected response Content-Type: %q", ct)
+	}
+	var reply string
+	if err := DecodeResponse(resp, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+}
+
+type sloppyArgs struct{}
+
+type SloppyService struct{}
+
+func (SloppyService) TooFew(r *http.Request, args *string) error                  { return nil }
+func (SloppyService) ValueArgs(r *http.Request, args string, reply *string) error { return nil }
+func (SloppyService) Unexported(r *http.Request, args *sloppyArgs, reply *string) error {
+	return nil
+}
+func (SloppyService) NoError(r *http.Request, args *string, reply *string) {}
+func (SloppyService) Helper() string                                       { return "" }
+func (SloppyService) Close() error                                         { return nil }
+
+// ClosableService has a Close method, which isn't meant to be called over
+// RPC.
+type ClosableService struct{}
+
+func (ClosableService) Ping(r *http.Request, args *string, reply *string) error { return nil }
+func (ClosableService) Close() error                                            { return nil }
+
+type PointerService struct{}
+
+func (*PointerService) Echo(r *http.Request, args *string, reply *string) error {
+	*reply = *args
+	return nil
+}
+
+func TestRegisterTypedService(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterTypedService(s, &SomeService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterTypedService(s, &HealthService{}); err != nil {
+		t.Fatalf("expected HealthService.ServeHTTP to be ignored, got %s", err)
+	}
+	if err := RegisterTypedService(s, ClosableService{}); err != nil {
+		t.Fatalf("expected ClosableService.Close to be ignored, got %s", err)
+	}
+	var reply string
+	if err := NewTestClient(s).Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	err = RegisterTypedService(s, SloppyService{})
+	if err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	for _, want := range []string{
+		"registering service gob.SloppyService: ",
+		"NoError must return only an error",
+		"TooFew must take (*http.Request, *Args, *Reply), but takes 2 params",
+		"Unexported must take its args as an exported type, not gob.sloppyArgs",
+		"ValueArgs must take its args as a pointer, not string",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %s", want, err)
+		}
+	}
+	for _, ignored := range []string{"Helper", "Close"} {
+		if strings.Contains(err.Error(), ignored) {
+			t.Errorf("expected %s to be ignored, got %s", ignored, err)
+		}
+	}
+
+	err = RegisterTypedService(s, PointerService{})
+	if err == nil || !strings.Contains(err.Error(), "register a *gob.PointerService instead") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
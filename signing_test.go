@@ -0,0 +1,116 @@
+package gob
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignedRequests(t *testing.T) {
+	secret := []byte("s3cret")
+	server := httptest.NewServer(VerifySignature(rs, secret))
+	defer server.Close()
+
+	var reply string
+	if err := NewClient(server.URL, NewSigningClient(secret)).Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+
+	for name, c := range map[string]*Client{
+		"unsigned":     NewClient(server.URL, nil),
+		"wrong secret": NewClient(server.URL, NewSigningClient([]byte("wrong"))),
+	} {
+		err := c.Call("SomeService.Echo", "hello", new(string))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifySignatureLimit(t *testing.T) {
+	secret := []byte("s3cret")
+	server := httptest.NewServer(VerifySignatureWithLimit(rs, secret, 256))
+	defer server.Close()
+
+	c := NewClient(server.URL, NewSigningClient(secret))
+	if err := c.Call("SomeService.Echo", "hi", new(string)); err != nil {
+		t.Fatal(err)
+	}
+	err := NewClient(server.URL, nil).Call("SomeService.Echo", strings.Repeat("x", 300), new(string))
+	var gobErr *Error
+	if !errors.As(err, &gobErr) || gobErr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a 413 response for an oversized body, got %v", err)
+	}
+}
+
+// recordingTransport records the requests sent through it.
+type recordingTransport struct {
+	base     http.RoundTripper
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return t.base.RoundTrip(req)
+}
+
+func TestSignedGetRequests(t *testing.T) {
+	secret := []byte("s3cret")
+	server := httptest.NewServer(VerifySignature(AllowGET(rs, 0, "SomeService.Echo"), secret))
+	defer server.Close()
+
+	rec := &recordingTransport{base: http.DefaultTransport}
+	hc := &http.Client{Transport: &signingTransport{secret: secret, base: rec}}
+	req, err := BuildGetRequest(server.URL, "SomeService.Echo", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	err = DecodeResponse(resp, &reply)
+	resp.Body.Close()
+	if err != nil || reply != "hello" {
+		t.Fatalf("expected a signed GET request to succeed, got %q, %v", reply, err)
+	}
+	sig := rec.requests[0].Header.Get(SignatureHeader)
+
+	// The signature of one call carried in a query doesn't authenticate
+	// another.
+	forged, err := BuildGetRequest(server.URL, "SomeService.Deadline", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Method = "POST"
+	forged.Header.Set("Content-Type", DefaultContentType)
+	forged.Header.Set(SignatureHeader, sig)
+	resp, err = http.DefaultClient.Do(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DecodeResponse(resp, new(int64))
+	resp.Body.Close()
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for a forged request, got %v", err)
+	}
+
+	// Nor is the query of a POST request read, even if it's signed, since
+	// it didn't pass through AllowGET.
+	forged.Header.Del(SignatureHeader)
+	resp, err = hc.Do(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DecodeResponse(resp, new(int64))
+	resp.Body.Close()
+	if err == nil || !strings.Contains(err.Error(), "empty gob-RPC request body") {
+		t.Errorf("expected the query of a POST request to be ignored, got %v", err)
+	}
+}
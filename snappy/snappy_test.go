@@ -0,0 +1,48 @@
+package snappy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gob "github.com/dradtke/gob-rpc"
+	"github.com/gorilla/rpc/v2"
+)
+
+type EchoService struct{}
+
+func (EchoService) Echo(r *http.Request, args *string, reply *string) error {
+	*reply = *args
+	return nil
+}
+
+func TestCompressor(t *testing.T) {
+	codec := gob.NewCodec()
+	codec.Compressors = []gob.Compressor{Compressor, gob.Gzip}
+	s := rpc.NewServer()
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterService(EchoService{}, "")
+
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		s.ServeHTTP(w, r)
+		encodings = append(encodings, w.Header().Get("Content-Encoding"))
+	}))
+	defer server.Close()
+
+	c := gob.NewClient(server.URL, nil)
+	c.Compressor = Compressor
+	var reply string
+	if err := c.Call("EchoService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+
+	server.Close() // so that the handler has recorded the response
+	if len(encodings) != 2 || encodings[0] != "snappy" || encodings[1] != "snappy" {
+		t.Errorf("unexpected request and response encodings: %v", encodings)
+	}
+}
@@ -0,0 +1,160 @@
+package gob
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Stream is the args type of a method that receives its params as a stream
+// of values, sent with Client.CallStream, instead of as a single value. The
+// method reads the values one at a time, so they never all have to be held
+// in memory:
+//
+//	func (s *Service) Ingest(r *http.Request, records *gob.Stream, reply *int) error {
+//		for {
+//			var rec Record
+//			if err := records.Decode(&rec); err == io.EOF {
+//				return nil
+//			} else if err != nil {
+//				return err
+//			}
+//			...
+//		}
+//	}
+//
+// The values are read straight from the request body, so Decode can only
+// be called until the method returns. A codec's MaxRequestBytes limit
+// applies to the stream as a whole.
+type Stream struct {
+	dec *gob.Decoder
+}
+
+// Decode decodes the next value in the stream into v, which must be a
+// pointer to the type of value that was sent. It returns io.EOF once every
+// value has been read.
+func (s *Stream) Decode(v interface{}) error {
+	if s.dec == nil {
+		return io.EOF
+	}
+	return sizeLimitError(s.dec.Decode(v))
+}
+
+// StreamEncoder sends the values of a call made with Client.CallStream.
+type StreamEncoder struct {
+	enc *gob.Encoder
+}
+
+// Encode sends v as the next value in the stream. Values don't have to be
+// registered, since they aren't sent as interfaces.
+func (e *StreamEncoder) Encode(v interface{}) error {
+	return encodeError(e.enc.Encode(v))
+}
+
+// CallStream invokes the named method, whose args must be a *Stream, and
+// decodes the result into reply. The values of the stream are produced by
+// send, which is called by another goroutine while the request is being
+// sent, so that they are never all held in memory.
+//
+// Since the request body can't be rebuilt, streamed calls are never
+// retried and don't fail over: only the first endpoint chosen by the
+// client's Selector is used. Client.Keepalive is ignored, so a slow method
+// must reply before any proxy on the way times out. An error returned by
+// send aborts the call, and is returned as is; since it says nothing about
+// the server, it isn't counted by the client's CircuitBreaker.
+func (c *Client) CallStream(ctx context.Context, method string, send func(*StreamEncoder) error, reply interface{}) error {
+	return c.intercept(ctx, method, send, reply, c.invokeStream)
+}
+
+// invokeStream makes a call for CallStream, once any interceptors have
+// been applied. The args must be the send function.
+func (c *Client) invokeStream(ctx context.Context, method string, args, reply interface{}) (err error) {
+	send, ok := args.(func(*StreamEncoder) error)
+	if !ok {
+		return NewError(fmt.Sprintf("invalid args: must be a func(*StreamEncoder) error, not %T", args))
+	}
+	if len(c.urls) == 0 {
+		return NewError("no endpoints configured")
+	}
+	if c.JSON {
+		return NewError("streams can't be sent by a JSON client")
+	}
+	var sendFailed bool
+	if c.CircuitBreaker != nil {
+		if !c.CircuitBreaker.allow() {
+			return ErrCircuitOpen
+		}
+		defer func() {
+			if sendFailed {
+				c.CircuitBreaker.abandon()
+			} else {
+				c.CircuitBreaker.record(ctx, err)
+			}
+		}()
+	}
+
+	selector := c.Selector
+	if selector == nil {
+		selector = InOrder
+	}
+	pr, pw := io.Pipe()
+	req, err := newBodyRequest(ctx, selector.Order(c.urls)[0], pr)
+	if err != nil {
+		return err
+	}
+	if c.ContentType != "" {
+		req.Header.Set("Content-Type", c.ContentType)
+	}
+	if c.Compressor != nil {
+		req.Header.Set("Content-Encoding", c.Compressor.Encoding())
+		req.Header.Set("Accept-Encoding", c.Compressor.Encoding())
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		err := c.writeStream(pw, method, send)
+		sendErr <- err
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// When the request fails, the transport closes the body, so
+		// send fails too. Its error only matters if it failed first.
+		if err := <-sendErr; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			sendFailed = true
+			return err
+		}
+		err = &TransportError{Err: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = decodeResponse(resp, reply, c.MaxResponseBytes)
+	return err
+}
+
+// writeStream writes a streamed request for the named method to w, with
+// the values produced by send, compressing it if the client has a
+// Compressor.
+func (c *Client) writeStream(w io.Writer, method string, send func(*StreamEncoder) error) error {
+	if c.Compressor != nil {
+		cw := c.Compressor.NewWriter(w)
+		if err := writeStream(cw, method, send); err != nil {
+			cw.Close()
+			return err
+		}
+		return cw.Close()
+	}
+	return writeStream(w, method, send)
+}
+
+func writeStream(w io.Writer, method string, send func(*StreamEncoder) error) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(&rpcRequest{Method: method, Id: IDGenerator(), Stream: true}); err != nil {
+		return err
+	}
+	return send(&StreamEncoder{enc: enc})
+}
@@ -0,0 +1,136 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type IngestService struct{}
+
+func (IngestService) Sum(r *http.Request, values *Stream, reply *int) error {
+	for {
+		var v int
+		if err := values.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		*reply += v
+	}
+}
+
+func sendInts(n int) func(*StreamEncoder) error {
+	return func(enc *StreamEncoder) error {
+		for i := 1; i <= n; i++ {
+			if err := enc.Encode(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func newIngestServer(t *testing.T) *httptest.Server {
+	s, err := NewServer(ServiceReg{Service: IngestService{}}, ServiceReg{Service: &SomeService{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(s)
+}
+
+func TestCallStream(t *testing.T) {
+	server := newIngestServer(t)
+	defer server.Close()
+
+	for _, comp := range []Compressor{nil, Gzip} {
+		c := NewClient(server.URL, nil)
+		c.Compressor = comp
+
+		var sum int
+		if err := c.CallStream(context.Background(), "IngestService.Sum", sendInts(1000), &sum); err != nil {
+			t.Fatal(err)
+		}
+		if sum != 500500 {
+			t.Errorf("expected a sum of 500500, got %d", sum)
+		}
+	}
+}
+
+func TestCallStreamSendError(t *testing.T) {
+	server := newIngestServer(t)
+	defer server.Close()
+
+	errStop := errors.New("stop")
+	var sum int
+	err := NewClient(server.URL, nil).CallStream(context.Background(), "IngestService.Sum", func(enc *StreamEncoder) error {
+		if err := enc.Encode(1); err != nil {
+			return err
+		}
+		return errStop
+	}, &sum)
+	if err != errStop {
+		t.Fatalf("expected the error returned by send, got %v", err)
+	}
+
+	// Errors from send aren't counted against the server, even if they
+	// are transport errors, such as from a call made by send.
+	c := NewClient(server.URL, nil)
+	c.CircuitBreaker = &CircuitBreaker{Threshold: 1, Cooldown: time.Hour}
+	for i := 0; i < 2; i++ {
+		err := c.CallStream(context.Background(), "IngestService.Sum", func(enc *StreamEncoder) error {
+			return &TransportError{Err: errStop}
+		}, &sum)
+		if !errors.Is(err, errStop) {
+			t.Fatalf("expected the error returned by send, got %v", err)
+		}
+	}
+	if state := c.CircuitBreaker.State(); state != CircuitClosed {
+		t.Errorf("expected the breaker to stay closed, but it is %v", state)
+	}
+}
+
+func TestStreamMismatch(t *testing.T) {
+	server := newIngestServer(t)
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+
+	var reply string
+	err := c.CallStream(context.Background(), "SomeService.Echo", sendInts(3), &reply)
+	if err == nil || !strings.Contains(err.Error(), "expected string, but got a stream") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+
+	var sum int
+	err = c.Call("IngestService.Sum", 3, &sum)
+	if err == nil || !strings.Contains(err.Error(), "expected a stream") {
+		t.Errorf("received unexpected error: %v", err)
+	}
+}
+
+func TestCallStreamUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String()
+	ln.Close()
+
+	c := NewClient(url, nil)
+	c.CircuitBreaker = &CircuitBreaker{Threshold: 1, Cooldown: time.Hour}
+	var reply int
+	err = c.CallStream(context.Background(), "IngestService.Sum", sendInts(1000), &reply)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected a *TransportError, got %T: %v", err, err)
+	}
+	if err := c.CallStream(context.Background(), "IngestService.Sum", sendInts(1), &reply); err != ErrCircuitOpen {
+		t.Errorf("expected the failure to open the circuit breaker, got %v", err)
+	}
+}
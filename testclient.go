@@ -0,0 +1,52 @@
+package gob
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// NewTestClient returns a Client whose calls are served directly by h,
+// which is usually the *rpc.Server under test, without going through a
+// network connection. It is intended for unit tests of service methods.
+func NewTestClient(h http.Handler) *Client {
+	return NewClient("http://gob-rpc.test/", &http.Client{Transport: handlerTransport{h}})
+}
+
+// handlerTransport is an http.RoundTripper that serves requests by
+// invoking a handler in-process.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// The handler is allowed to modify the request it's given, and the
+	// codec does, so give it a copy that looks like an incoming request.
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "192.0.2.1:1234"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	w := newResponseBuffer()
+	t.h.ServeHTTP(w, r)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          ioutil.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,39 @@
+package gob
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTestClient(t *testing.T) {
+	c := NewTestClient(rs)
+
+	var reply string
+	if err := c.Call("SomeService.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "hello" {
+		t.Errorf("received unexpected response: %s", reply)
+	}
+
+	var rpcErr *RPCError
+	if err := c.Call("SomeService.Error", nil, nil); !errors.As(err, &rpcErr) || err.Error() != "uh-oh" {
+		t.Fatalf("expected an *RPCError, got %T: %v", err, err)
+	}
+
+	if err := c.Notify("SomeService.Echo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTestClientContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var reply string
+	err := NewTestClient(rs).CallContext(ctx, "SomeService.Echo", "hello", &reply)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package gob
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/rpc/v2"
+)
+
+type traceKey struct{}
+
+func (s *SomeService) Trace(r *http.Request, _ *struct{}, reply *string) error {
+	*reply, _ = r.Context().Value(traceKey{}).(string)
+	return nil
+}
+
+func TestTracePropagation(t *testing.T) {
+	defer func(f func(context.Context, http.Header)) { TraceInjector = f }(TraceInjector)
+	TraceInjector = func(ctx context.Context, header http.Header) {
+		if trace, ok := ctx.Value(traceKey{}).(string); ok {
+			header.Set("traceparent", trace)
+		}
+	}
+
+	codec := NewCodec()
+	codec.TraceExtractor = func(ctx context.Context, header http.Header) context.Context {
+		return context.WithValue(ctx, traceKey{}, header.Get("traceparent"))
+	}
+	s := rpc.NewServer()
+	s.RegisterCodec(codec, "application/gob")
+	s.RegisterService(&SomeService{}, "")
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	const trace = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := context.WithValue(context.Background(), traceKey{}, trace)
+
+	var reply string
+	if err := NewClient(server.URL, nil).CallContext(ctx, "SomeService.Trace", nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != trace {
+		t.Errorf("expected the handler to see trace %q, got %q", trace, reply)
+	}
+}
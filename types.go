@@ -0,0 +1,149 @@
+package gob
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// registeredTypes holds the names of the types registered through this
+// package. encoding/gob doesn't expose its own registry, so types that are
+// registered by calling gob.Register directly aren't included.
+var registeredTypes struct {
+	sync.Mutex
+	names map[string]bool
+}
+
+func recordType(name string) {
+	registeredTypes.Lock()
+	defer registeredTypes.Unlock()
+	if registeredTypes.names == nil {
+		registeredTypes.names = make(map[string]bool)
+	}
+	registeredTypes.names[name] = true
+}
+
+// RegisteredTypes returns the sorted gob names of the types that have been
+// registered using Register(), RegisterName() or RegisterTypes().
+func RegisteredTypes() []string {
+	registeredTypes.Lock()
+	defer registeredTypes.Unlock()
+	names := make([]string, 0, len(registeredTypes.names))
+	for name := range registeredTypes.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gobName returns the name that gob.Register uses for the type of value.
+// Like gob, it uses the short String() form for unnamed types, including
+// pointers to named types.
+func gobName(value interface{}) string {
+	rt := reflect.TypeOf(value)
+	switch {
+	case rt.Name() == "":
+		return rt.String()
+	case rt.PkgPath() == "":
+		return rt.Name()
+	default:
+		return rt.PkgPath() + "." + rt.Name()
+	}
+}
+
+// RequireTypes checks that values of each of the given types can be sent
+// as params or results, which requires them to have been registered with
+// gob, and returns an error describing those that can't. It is meant to be
+// called once at startup, after all types have been registered, so that a
+// missing registration is caught then rather than when a request first
+// fails with a less helpful error:
+//
+//	if err := gob.RequireTypes(Args{}, Reply{}, &CustomError{}); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// encoding/gob keeps a single registry for the whole process, so types
+// can't be required of one Codec and not another: the check applies to
+// every codec alike.
+func RequireTypes(values ...interface{}) error {
+	var problems []string
+	for _, value := range values {
+		if err := checkEncodable(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%T (%s)", value, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("gob types can't be sent: %s; register them with gob.Register()", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkEncodable returns an error if value can't be sent in the Params or
+// Result of a gob-RPC message, which are interface values.
+func checkEncodable(value interface{}) error {
+	return gob.NewEncoder(ioutil.Discard).Encode(&rpcRequest{Params: value})
+}
+
+// TypeService is a service that reports the types registered with this
+// package on the server, so that clients can detect registration drift
+// before real calls fail. Register it with a Gorilla RPC server to make
+// Client.CheckTypes available:
+//
+//	s.RegisterService(&gob.TypeService{}, "")
+type TypeService struct{}
+
+// Describe replies with the result of RegisteredTypes() on the server.
+func (s *TypeService) Describe(r *http.Request, _ *struct{}, reply *[]string) error {
+	*reply = RegisteredTypes()
+	return nil
+}
+
+// CheckTypes compares the types registered on the client with those
+// registered on the server, which must have a TypeService registered. It
+// returns an error describing any types registered on only one side.
+func (c *Client) CheckTypes() error {
+	var remote []string
+	if err := c.Call("TypeService.Describe", nil, &remote); err != nil {
+		return err
+	}
+	return compareTypes(RegisteredTypes(), remote)
+}
+
+// compareTypes returns an error listing the type names that appear in only
+// one of local and remote.
+func compareTypes(local, remote []string) error {
+	var onlyLocal, onlyRemote []string
+	inRemote := make(map[string]bool, len(remote))
+	for _, name := range remote {
+		inRemote[name] = true
+	}
+	inLocal := make(map[string]bool, len(local))
+	for _, name := range local {
+		inLocal[name] = true
+		if !inRemote[name] {
+			onlyLocal = append(onlyLocal, name)
+		}
+	}
+	for _, name := range remote {
+		if !inLocal[name] {
+			onlyRemote = append(onlyRemote, name)
+		}
+	}
+
+	var problems []string
+	if len(onlyLocal) > 0 {
+		problems = append(problems, "registered only on the client: "+strings.Join(onlyLocal, ", "))
+	}
+	if len(onlyRemote) > 0 {
+		problems = append(problems, "registered only on the server: "+strings.Join(onlyRemote, ", "))
+	}
+	if len(problems) > 0 {
+		return NewError("gob type mismatch: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package gob
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGobName(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  string
+	}{
+		{"", "string"},
+		{&Error{}, "*gob.Error"},
+		{Values{}, "github.com/dradtke/gob-rpc.Values"},
+		{[]int{}, "[]int"},
+		{limitError{}, "github.com/dradtke/gob-rpc.limitError"},
+	} {
+		if got := gobName(test.value); got != test.want {
+			t.Errorf("gobName(%T) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	if err := NewClient(ts.URL, nil).CheckTypes(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareTypes(t *testing.T) {
+	err := compareTypes([]string{"a", "b"}, []string{"b", "c"})
+	if err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	if want := "gob type mismatch: registered only on the client: a; registered only on the server: c"; err.Error() != want {
+		t.Fatalf("received unexpected error: %s", err)
+	}
+}
+
+func TestRequireTypes(t *testing.T) {
+	if err := RequireTypes("", &Error{}, Values{}, limitError{}); err != nil {
+		t.Fatal(err)
+	}
+
+	type unregistered struct{ X int }
+	err := RequireTypes("", unregistered{}, &Error{}, &unregistered{})
+	if err == nil {
+		t.Fatal("expected an error, but none was returned")
+	}
+	for _, want := range []string{"gob.unregistered (", "*gob.unregistered (", "type not registered"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q: %s", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "*gob.Error") {
+		t.Errorf("registered type reported as missing: %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+package gob
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Values is a reply type for methods that return more than one value, such
+// as a page of results along with a cursor for the next page. It saves
+// defining a dedicated reply struct for every such method:
+//
+//	func (s *Service) List(r *http.Request, args *string, reply *gob.Values) error {
+//		*reply = gob.Values{items, cursor}
+//		return nil
+//	}
+//
+// The client decodes the reply into a Values and then calls Scan to copy
+// each value into its own variable:
+//
+//	var reply gob.Values
+//	if err := client.Call("Service.List", "", &reply); err != nil {
+//		return err
+//	}
+//	var (
+//		items  []string
+//		cursor int
+//	)
+//	err := reply.Scan(&items, &cursor)
+//
+// Values is encoded by gob as a slice of interface values, so just like a
+// regular result, the concrete type of each element must be registered on
+// both ends unless it is a built-in type.
+type Values []interface{}
+
+// Scan copies each value into the corresponding pointer in dest. It returns
+// an error if the number of pointers doesn't match the number of values,
+// or if a value can't be assigned to its pointer.
+func (v Values) Scan(dest ...interface{}) error {
+	if len(dest) != len(v) {
+		return NewError(fmt.Sprintf("invalid number of values: expected %d, but got %d", len(dest), len(v)))
+	}
+
+	for i, d := range dest {
+		pv := reflect.ValueOf(d)
+		if pv.Kind() != reflect.Ptr || pv.IsNil() {
+			return NewError(fmt.Sprintf("invalid destination for value %d: must be a non-nil pointer", i))
+		}
+
+		va := pv.Elem()
+		if v[i] == nil {
+			va.Set(reflect.Zero(va.Type()))
+			continue
+		}
+		vb := reflect.ValueOf(v[i])
+		if !vb.Type().AssignableTo(va.Type()) {
+			return NewError(fmt.Sprintf("invalid value %d: got %s, not %s", i, vb.Type(), va.Type()))
+		}
+		va.Set(vb)
+	}
+	return nil
+}
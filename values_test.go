@@ -0,0 +1,50 @@
+package gob
+
+import (
+	"net/http"
+	"testing"
+)
+
+func (s *SomeService) Page(_ *http.Request, args *int, reply *Values) error {
+	*reply = Values{[]string{"a", "b"}, *args + 2}
+	return nil
+}
+
+func TestValues(t *testing.T) {
+	var reply Values
+	if err := doRequest("SomeService.Page", 0, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		items  []string
+		cursor int
+	)
+	if err := reply.Scan(&items, &cursor); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0] != "a" || items[1] != "b" {
+		t.Errorf("received unexpected items: %v", items)
+	}
+	if cursor != 2 {
+		t.Errorf("received unexpected cursor: %d", cursor)
+	}
+}
+
+func TestValuesScanErrors(t *testing.T) {
+	v := Values{"a", 1}
+
+	var s string
+	if err := v.Scan(&s); err == nil {
+		t.Error("expected an error for too few destinations, but none was returned")
+	}
+
+	var n int
+	if err := v.Scan(&n, &s); err == nil {
+		t.Error("expected an error for mismatched types, but none was returned")
+	}
+
+	if err := v.Scan(s, &n); err == nil {
+		t.Error("expected an error for a non-pointer destination, but none was returned")
+	}
+}